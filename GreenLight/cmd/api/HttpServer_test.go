@@ -1,29 +1,22 @@
 package main
 
 import (
-	"flag"
-	"fmt"
-	"log"
+	"DesignMode/GreenLight/internal/jsonlog"
+	"io"
 	"net/http"
-	"os"
+	"net/http/httptest"
 	"testing"
-	"time"
 )
 
 // TestHttpServer 是一个测试函数，用于启动 HTTP 服务器。
-// 主要功能包括解析命令行参数、初始化日志记录器和应用程序结构体、设置路由并启动服务器。
+// 主要功能包括初始化日志记录器和应用程序结构体、设置路由、启动服务器并请求健康检查端点。
 func TestHttpServer(t *testing.T) {
 	var cfg config
-
-	// 解析命令行参数以初始化配置。
-	// TODO 端口和环境变量都可以自定义
-	// go run ./cmd/api -port=3030 -env=production
-	flag.IntVar(&cfg.port, "port", 4000, "API 服务器端口")
-	flag.StringVar(&cfg.env, "env", "development", "环境 (development|staging|production)")
-	flag.Parse()
+	cfg.port = 4000
+	cfg.env = "development"
 
 	// 初始化日志记录器。
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	logger := jsonlog.NewLogger(io.Discard, jsonlog.LevelInfo)
 	app := &application{
 		config: cfg,
 		logger: logger,
@@ -33,17 +26,17 @@ func TestHttpServer(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/healthcheck", app.healthcheckHandler)
 
-	// 配置 HTTP 服务器。
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      mux,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+	// 启动测试 HTTP 服务器。
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL + "/v1/healthcheck")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer res.Body.Close()
 
-	// 启动 HTTP 服务器。
-	logger.Printf("正在启动 %s 环境下的服务器，监听地址为 %s", cfg.env, srv.Addr)
-	err := srv.ListenAndServe()
-	logger.Fatal(err)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status %d; got %d", http.StatusOK, res.StatusCode)
+	}
 }
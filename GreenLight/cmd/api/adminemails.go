@@ -0,0 +1,116 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/validator"
+	"errors"
+	"net/http"
+)
+
+// TODO 该文件存储发件箱的管理接口：查看邮件的投递状态和失败原因，重试不再自动重试（dead）的邮件
+
+// 列出发件箱中的邮件 listEmailsHandler
+func (app *application) listEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafeList = []string{"created_at", "-created_at", "next_attempt_at", "-next_attempt_at", "attempts", "-attempts"}
+
+	v.Check(input.Status == "" || validator.In(input.Status, data.EmailPending, data.EmailSending, data.EmailSent, data.EmailDead),
+		"status", "must be pending, sending, sent or dead")
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	emails, metadata, err := app.models.WithContext(r.Context()).Emails.GetAll(input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"emails": emails, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 查看邮件的投递状态 showEmailHandler
+func (app *application) showEmailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	email, err := app.models.WithContext(r.Context()).Emails.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"email": email}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 重试投递失败的邮件 retryEmailHandler，只能重试dead状态的邮件，尝试次数从0重新计算
+func (app *application) retryEmailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	models := app.models.WithContext(r.Context())
+	email, err := models.Emails.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if email.Status != data.EmailDead {
+		v := validator.New()
+		v.AddError("status", "only dead emails can be retried")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = models.Emails.Retry(email.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.wakeMailWorkers()
+
+	app.audit(r, "email.retry", "email", email.ID, map[string]interface{}{"template": email.Template})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "the email has been queued for delivery"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TODO 该文件存储管理员的用户管理接口（需要users:admin权限）
+
+// 用户列表 listUsersHandler
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	// 声明结构体 input
+	var input struct {
+		Name      string
+		Email     string
+		Activated *bool
+		data.Filters
+	}
+	v := validator.New()
+	// 获取查询字符串参数
+	qs := r.URL.Query()
+	input.Name = app.readString(qs, "name", "")
+	input.Email = app.readString(qs, "email", "")
+	input.Activated = app.readBool(qs, "activated", v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+	// 验证过滤器
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.WithContext(r.Context()).Users.GetAll(input.Name, input.Email, input.Activated, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 查看用户及其权限 showUserHandler
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.WithContext(r.Context()).Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 展开后的全部权限（包括通过角色获得的权限）
+	permissions, err := app.models.WithContext(r.Context()).Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roles, err := app.models.WithContext(r.Context()).Roles.GetAll(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// version 用于后续修改时的乐观锁
+	env := envelope{
+		"user":        user,
+		"version":     user.Version,
+		"permissions": permissions,
+		"roles":       roles,
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 激活或停用用户 updateUserStatusHandler
+func (app *application) updateUserStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// version 为客户端看到的版本，提供时必须与数据库中的版本一致
+	var input struct {
+		Activated *bool `json:"activated"`
+		Version   *int  `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Activated != nil, "activated", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.WithContext(r.Context()).Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Version != nil && *input.Version != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	// 记录停用时间，与从未激活的账户区分：停用的账户不能通过激活令牌或社交登录重新启用
+	if user.Activated != *input.Activated {
+		user.Activated = *input.Activated
+		if user.Activated {
+			user.DeactivatedAt = nil
+		} else {
+			now := time.Now()
+			user.DeactivatedAt = &now
+		}
+	}
+
+	err = app.models.WithContext(r.Context()).Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 停用用户时让已签发的认证令牌失效
+	if !user.Activated {
+		err = app.models.WithContext(r.Context()).Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	action := "user.deactivate"
+	if user.Activated {
+		action = "user.activate"
+	}
+	app.audit(r, action, "user", user.ID, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "version": user.Version}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 强制重置用户密码 resetUserPasswordHandler
+// 原密码和已签发的认证令牌立即失效，并向用户发送一封带有重置令牌的邮件
+func (app *application) resetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.WithContext(r.Context()).Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 使用随机密码替换原密码
+	err = user.Password.SetRandom()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 在同一个事务中更新密码、删除旧令牌、生成重置令牌并写入重置邮件，写入发件箱失败时密码不会被修改
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		err := tx.Users.Update(user)
+		if err != nil {
+			return err
+		}
+
+		// 删除已有的认证令牌和未使用的重置令牌
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopePasswordReset} {
+			err = tx.Tokens.DeleteAllForUser(scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// 生成令牌，并设置其过期时间为45分钟，并使用 ScopePasswordReset 作为作用域
+		token, err := tx.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		mailData := map[string]interface{}{
+			"passwordResetToken": token.Plaintext,
+		}
+		return app.queueMail(tx, user, "token_password_reset.tmpl", mailData)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.notifyMailQueued()
+
+	// 重置密码后解除账户锁定
+	app.loginGuard.reset(user.Email)
+
+	app.audit(r, "user.password.reset", "user", user.ID, nil)
+
+	env := envelope{"message": "the user's password has been reset and an email will be sent with instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 为用户授予权限 grantUserPermissionsHandler
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// 权限必须存在于permissions表中
+	known, err := app.models.WithContext(r.Context()).Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	for _, code := range input.Permissions {
+		v.Check(known.Include(code), "permissions", fmt.Sprintf("unknown permission %q", code))
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.WithContext(r.Context()).Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.WithContext(r.Context()).Permissions.AddForUser(id, input.Permissions...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, "user.permission.grant", "user", id, map[string]interface{}{
+		"permissions": input.Permissions,
+	})
+
+	permissions, err := app.models.WithContext(r.Context()).Permissions.GetAllForUser(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 收回用户权限 revokeUserPermissionHandler
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	code := app.readStringParam(r, "code")
+
+	err = app.models.WithContext(r.Context()).Permissions.RemoveForUser(id, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, "user.permission.revoke", "user", id, map[string]interface{}{
+		"permission": code,
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "permission successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 删除用户 deleteUserHandler
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// 管理员不能删除自己的账户
+	if id == app.contextGetUser(r).ID {
+		v := validator.New()
+		v.AddError("id", "you cannot delete your own account")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.WithContext(r.Context()).Users.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, "user.delete", "user", id, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/jwt"
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAdminTestApplication 创建使用execDB的测试应用，用户5的记录为target（为nil时用户不存在），
+// 返回持有permissions的管理员（用户1）的JWT
+func newAdminTestApplication(t *testing.T, target []driver.Value, permissions ...string) (*application, *execDB, string) {
+	t.Helper()
+
+	app := newTestApplication(t)
+	app.config.auth.mode = authModeJWT
+	app.config.auth.jwt.ttl = time.Hour
+	key, err := jwt.NewHMACKey("k1", bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.jwtKeys = jwt.NewKeySet(key)
+
+	users := [][]driver.Value{}
+	if target != nil {
+		users = append(users, target)
+	}
+	db := &execDB{rows: map[string][][]driver.Value{
+		"WHERE id = ?":                        users,
+		"ORDER BY code":                       codeRows([]string{"movies:read", "movies:write", "users:admin"}),
+		"WHERE users_permissions.user_id = ?": codeRows([]string{"movies:read", "movies:write"}),
+	}}
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() { conn.Close() })
+	app.models = data.NewModels(conn)
+
+	token, err := app.newJWT(&data.User{ID: 1, Activated: true}, permissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app, db, token.Plaintext
+}
+
+// testUserRow 返回用户5的查询结果，version为1
+func testUserRow(activated bool, deactivatedAt interface{}) []driver.Value {
+	return []driver.Value{int64(5), time.Now(), "Alice", "alice@example.com", []byte("hash"), activated, deactivatedAt, "en", int64(1)}
+}
+
+// serveAdmin 通过完整的路由发送一个管理员请求，token为空时为匿名请求
+func serveAdmin(app *application, method, path, body, token string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	app.routes().ServeHTTP(rr, r)
+	return rr
+}
+
+// auditAction 返回写入审计日志的操作，没有写入时返回空字符串
+func auditAction(db *execDB) string {
+	insert, ok := db.find("INSERT INTO audit_log")
+	if !ok {
+		return ""
+	}
+	return insert.args[2].(string)
+}
+
+// TestAdminUsersRequirePermission 测试用户管理接口需要users:admin权限
+func TestAdminUsersRequirePermission(t *testing.T) {
+	endpoints := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/v1/admin/users", ""},
+		{http.MethodGet, "/v1/admin/users/5", ""},
+		{http.MethodPatch, "/v1/admin/users/5", `{"activated": false}`},
+		{http.MethodDelete, "/v1/admin/users/5", ""},
+		{http.MethodPost, "/v1/admin/users/5/password-reset", ""},
+		{http.MethodPost, "/v1/admin/users/5/permissions", `{"permissions": ["movies:write"]}`},
+		{http.MethodDelete, "/v1/admin/users/5/permissions/movies:read", ""},
+	}
+
+	for _, e := range endpoints {
+		t.Run(e.method+" "+e.path, func(t *testing.T) {
+			app, db, token := newAdminTestApplication(t, testUserRow(true, nil), "movies:read", "movies:write")
+
+			if rr := serveAdmin(app, e.method, e.path, e.body, ""); rr.Code != http.StatusUnauthorized {
+				t.Errorf("want 401 for anonymous requests; got %d", rr.Code)
+			}
+			if rr := serveAdmin(app, e.method, e.path, e.body, token); rr.Code != http.StatusForbidden {
+				t.Errorf("want 403 without users:admin; got %d", rr.Code)
+			}
+			if len(db.execs) != 0 || len(db.queries) != 0 {
+				t.Errorf("want the database untouched; got %v %v", db.execs, db.queries)
+			}
+		})
+	}
+}
+
+// TestUpdateUserStatus 测试停用用户时记录停用时间并吊销认证令牌，重新启用时清除停用时间，
+// 以及version不一致时返回409
+func TestUpdateUserStatus(t *testing.T) {
+	deactivatedAt := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name            string
+		target          []driver.Value
+		body            string
+		conflict        bool
+		wantStatus      int
+		wantDeactivated bool
+		wantRevoke      bool
+		wantAudit       string
+	}{
+		{"deactivate", testUserRow(true, nil), `{"activated": false, "version": 1}`, false, http.StatusOK, true, true, "user.deactivate"},
+		{"reactivate", testUserRow(false, deactivatedAt), `{"activated": true}`, false, http.StatusOK, false, false, "user.activate"},
+		{"stale version", testUserRow(true, nil), `{"activated": false, "version": 3}`, false, http.StatusConflict, false, false, ""},
+		{"concurrent update", testUserRow(true, nil), `{"activated": false, "version": 1}`, true, http.StatusConflict, false, false, ""},
+		{"missing activated", testUserRow(true, nil), `{"version": 1}`, false, http.StatusUnprocessableEntity, false, false, ""},
+		{"unknown user", nil, `{"activated": false}`, false, http.StatusNotFound, false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db, token := newAdminTestApplication(t, tt.target, "users:admin")
+			if tt.conflict {
+				db.noRows = "UPDATE users"
+			}
+
+			rr := serveAdmin(app, http.MethodPatch, "/v1/admin/users/5", tt.body, token)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("want status %d; got %d %s", tt.wantStatus, rr.Code, rr.Body)
+			}
+
+			update, updated := db.find("UPDATE users")
+			if tt.wantStatus == http.StatusOK {
+				if !updated {
+					t.Fatal("want the user updated")
+				}
+				if update.args[3] != !tt.wantDeactivated {
+					t.Errorf("want activated %v; got %v", !tt.wantDeactivated, update.args[3])
+				}
+				if _, ok := update.args[4].(time.Time); ok != tt.wantDeactivated {
+					t.Errorf("want deactivated_at set %v; got %v", tt.wantDeactivated, update.args[4])
+				}
+				if update.args[6] != int64(5) || update.args[7] != int64(1) {
+					t.Errorf("want the update guarded by id and version; got %v", update.args)
+				}
+			} else if updated && !tt.conflict {
+				t.Error("want the user not updated")
+			}
+
+			revoke, revoked := db.find("DELETE FROM tokens")
+			if revoked != tt.wantRevoke {
+				t.Fatalf("want authentication tokens revoked %v; got %v", tt.wantRevoke, revoked)
+			}
+			if revoked && (revoke.args[0] != data.ScopeAuthentication || revoke.args[1] != int64(5)) {
+				t.Errorf("want the user's authentication tokens revoked; got %v", revoke.args)
+			}
+			if action := auditAction(db); action != tt.wantAudit {
+				t.Errorf("want audit action %q; got %q", tt.wantAudit, action)
+			}
+		})
+	}
+}
+
+// TestGrantUserPermissions 测试只能授予permissions表中存在的权限，并记录审计日志
+func TestGrantUserPermissions(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     []driver.Value
+		body       string
+		wantStatus int
+	}{
+		{"known permission", testUserRow(true, nil), `{"permissions": ["movies:write"]}`, http.StatusOK},
+		{"unknown permission", testUserRow(true, nil), `{"permissions": ["movies:delete"]}`, http.StatusUnprocessableEntity},
+		{"no permissions", testUserRow(true, nil), `{"permissions": []}`, http.StatusUnprocessableEntity},
+		{"unknown user", nil, `{"permissions": ["movies:write"]}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db, token := newAdminTestApplication(t, tt.target, "users:admin")
+
+			rr := serveAdmin(app, http.MethodPost, "/v1/admin/users/5/permissions", tt.body, token)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("want status %d; got %d %s", tt.wantStatus, rr.Code, rr.Body)
+			}
+
+			grant, granted := db.find("INSERT IGNORE INTO users_permissions")
+			if tt.wantStatus != http.StatusOK {
+				if granted || auditAction(db) != "" {
+					t.Errorf("want nothing written; got %v", db.execs)
+				}
+				return
+			}
+			if !granted || grant.args[0] != int64(5) || grant.args[1] != "movies:write" {
+				t.Fatalf("want movies:write granted to user 5; got %v", db.execs)
+			}
+			if action := auditAction(db); action != "user.permission.grant" {
+				t.Errorf("want grant audited; got %q", action)
+			}
+			if !strings.Contains(rr.Body.String(), `"movies:write"`) {
+				t.Errorf("want the user's permissions in the response; got %s", rr.Body)
+			}
+		})
+	}
+}
+
+// TestRevokeUserPermission 测试收回用户直接授予的权限，用户没有该权限时返回404
+func TestRevokeUserPermission(t *testing.T) {
+	for _, found := range []bool{true, false} {
+		app, db, token := newAdminTestApplication(t, testUserRow(true, nil), "users:admin")
+		if !found {
+			db.noRows = "DELETE users_permissions"
+		}
+
+		rr := serveAdmin(app, http.MethodDelete, "/v1/admin/users/5/permissions/movies:read", "", token)
+		wantStatus, wantAudit := http.StatusOK, "user.permission.revoke"
+		if !found {
+			wantStatus, wantAudit = http.StatusNotFound, ""
+		}
+		if rr.Code != wantStatus {
+			t.Fatalf("found=%v: want status %d; got %d %s", found, wantStatus, rr.Code, rr.Body)
+		}
+
+		revoke, ok := db.find("DELETE users_permissions")
+		if !ok || revoke.args[0] != int64(5) || revoke.args[1] != "movies:read" {
+			t.Errorf("want movies:read revoked from user 5; got %v", db.execs)
+		}
+		if action := auditAction(db); action != wantAudit {
+			t.Errorf("found=%v: want audit action %q; got %q", found, wantAudit, action)
+		}
+	}
+}
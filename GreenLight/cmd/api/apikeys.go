@@ -0,0 +1,114 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 创建API密钥 createAPIKeyHandler
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	// 声明结构体 input，expiry 为空表示永不过期
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	// 读取JSON请求体数据到input结构体中
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// 密钥的权限必须是用户当前权限的子集
+	granted, err := app.models.WithContext(r.Context()).Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// 凭证自带权限时（例如JWT），还不能超过凭证的权限
+	if permissions, ok := app.contextGetPermissions(r); ok {
+		granted = permissions.Intersect(granted)
+	}
+
+	key := &data.APIKey{
+		Name:        input.Name,
+		Permissions: input.Permissions,
+		Expiry:      input.Expiry,
+	}
+
+	v := validator.New()
+	if data.ValidateAPIKey(v, key, granted); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 生成并保存API密钥（数据库中只保存哈希值）
+	key, err = app.models.WithContext(r.Context()).APIKeys.New(user.ID, key.Name, key.Permissions, key.Expiry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 创建Location响应头
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/api-keys/%d", key.ID))
+
+	// 明文密钥只在此处返回一次
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 列出API密钥 listAPIKeysHandler
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	keys, err := app.models.WithContext(r.Context()).APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 吊销API密钥 revokeAPIKeyHandler
+func (app *application) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	// 获取路由参数
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// 只能吊销自己的密钥，其他用户的密钥视为不存在
+	err = app.models.WithContext(r.Context()).APIKeys.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
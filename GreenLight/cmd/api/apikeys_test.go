@@ -0,0 +1,263 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/jwt"
+	"DesignMode/GreenLight/internal/validator"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAPIKey 格式正确的API密钥明文
+var testAPIKey = data.APIKeyPrefix + strings.Repeat("A", 52)
+
+// newAPIKeyTestApplication 创建使用execDB的测试应用，用户7是已激活的用户，
+// 直接授予的权限为granted，testAPIKey属于用户7，密钥的权限为keyPermissions
+func newAPIKeyTestApplication(t *testing.T, granted, keyPermissions []string) (*application, *execDB) {
+	t.Helper()
+
+	app := newTestApplication(t)
+	app.config.auth.mode = authModeJWT
+	app.config.auth.jwt.ttl = time.Hour
+	key, err := jwt.NewHMACKey("k1", bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.jwtKeys = jwt.NewKeySet(key)
+
+	db := &execDB{rows: map[string][][]driver.Value{
+		"WHERE api_keys.hash = ?": {{
+			int64(3), int64(7), time.Now(), "Batch", "batch@example.com", []byte("hash"), true, nil, "en", int64(1),
+		}},
+		"WHERE api_keys_permissions.api_key_id = ?": codeRows(keyPermissions),
+		"WHERE users_permissions.user_id = ?":       codeRows(granted),
+	}}
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() { conn.Close() })
+	app.models = data.NewModels(conn)
+
+	return app, db
+}
+
+// codeRows 将权限代码转换为单列的查询结果
+func codeRows(codes []string) [][]driver.Value {
+	rows := [][]driver.Value{}
+	for _, code := range codes {
+		rows = append(rows, []driver.Value{code})
+	}
+	return rows
+}
+
+// TestAuthenticateAPIKey 测试ApiKey请求头的解析、按哈希查询未过期的密钥，以及密钥权限与用户当前权限取交集
+func TestAuthenticateAPIKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		permission    string
+		unknownKey    bool
+		wantStatus    int
+		wantLookup    bool
+	}{
+		{"valid key", "ApiKey " + testAPIKey, "movies:read", false, http.StatusOK, true},
+		{"permission revoked from user", "ApiKey " + testAPIKey, "users:admin", false, http.StatusForbidden, true},
+		{"permission not on key", "ApiKey " + testAPIKey, "movies:write", false, http.StatusForbidden, true},
+		{"unknown or expired key", "ApiKey " + testAPIKey, "movies:read", true, http.StatusUnauthorized, true},
+		{"missing prefix", "ApiKey " + strings.Repeat("A", 55), "movies:read", false, http.StatusUnauthorized, false},
+		{"wrong length", "ApiKey " + data.APIKeyPrefix + "AAAA", "movies:read", false, http.StatusUnauthorized, false},
+		{"extra field", "ApiKey " + testAPIKey + " x", "movies:read", false, http.StatusUnauthorized, false},
+		{"scheme is case sensitive", "apikey " + testAPIKey, "movies:read", false, http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 密钥带有users:admin，但用户已经被收回该权限
+			app, db := newAPIKeyTestApplication(t, []string{"movies:read", "movies:write"}, []string{"movies:read", "users:admin"})
+			if tt.unknownKey {
+				db.rows["WHERE api_keys.hash = ?"] = [][]driver.Value{}
+			}
+
+			handler := app.authenticate(app.requirePermission(tt.permission, func(w http.ResponseWriter, r *http.Request) {
+				if id := app.contextGetUser(r).ID; id != 7 {
+					t.Errorf("want user id 7; got %d", id)
+				}
+				if credential := app.contextGetCredential(r); !strings.HasPrefix(credential, apiKeyCredentialPrefix) || strings.Contains(credential, testAPIKey) {
+					t.Errorf("want hashed api key credential; got %q", credential)
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			r.Header.Set("Authorization", tt.authorization)
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("want status %d; got %d %s", tt.wantStatus, rr.Code, rr.Body)
+			}
+			if !tt.wantLookup {
+				if len(db.queries) != 0 {
+					t.Errorf("want malformed key rejected without a database lookup; got %d queries", len(db.queries))
+				}
+				return
+			}
+
+			// 数据库中只保存哈希值，过期的密钥由查询条件排除
+			lookup := db.queries[0]
+			hash := sha256.Sum256([]byte(testAPIKey))
+			if !bytes.Equal(lookup.args[0].([]byte), hash[:]) {
+				t.Error("want the key looked up by its sha256 hash")
+			}
+			if now, ok := lookup.args[1].(time.Time); !ok || time.Since(now) > time.Minute {
+				t.Errorf("want expiry compared with the current time; got %v", lookup.args[1])
+			}
+		})
+	}
+}
+
+// TestAPIKeyCannotManageCredentials 测试使用API密钥不能创建、吊销密钥或修改两步验证，
+// 权限受限的密钥不能为用户签发权限更大的密钥
+func TestAPIKeyCannotManageCredentials(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/v1/api-keys", `{"name": "escalated", "permissions": ["users:admin", "roles:admin"]}`},
+		{http.MethodDelete, "/v1/api-keys/4", ""},
+		{http.MethodPost, "/v1/users/2fa", ""},
+		{http.MethodPut, "/v1/users/2fa/confirm", `{"code": "123456"}`},
+		{http.MethodDelete, "/v1/users/2fa", `{"code": "123456"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			app, db := newAPIKeyTestApplication(t, []string{"movies:read", "users:admin", "roles:admin"}, []string{"movies:read"})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "ApiKey "+testAPIKey)
+			app.routes().ServeHTTP(rr, r)
+
+			if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "API key") {
+				t.Fatalf("want 403 for api key credentials; got %d %s", rr.Code, rr.Body)
+			}
+			if len(db.execs) != 0 {
+				t.Errorf("want nothing written; got %+v", db.execs)
+			}
+		})
+	}
+}
+
+// TestCreateAPIKey 测试创建的密钥只保存哈希值，权限不能超过用户和当前凭证的权限，过期时间必须在未来
+func TestCreateAPIKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions string
+		expiry      string
+		wantStatus  int
+	}{
+		{"subset", `["movies:read"]`, "null", http.StatusCreated},
+		{"granted to user but not to token", `["movies:read", "users:admin"]`, "null", http.StatusUnprocessableEntity},
+		{"not granted", `["roles:admin"]`, "null", http.StatusUnprocessableEntity},
+		{"expired", `["movies:read"]`, `"2020-01-01T00:00:00Z"`, http.StatusUnprocessableEntity},
+		{"future expiry", `["movies:read"]`, `"` + time.Now().Add(24*time.Hour).UTC().Format(time.RFC3339) + `"`, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := newAPIKeyTestApplication(t, []string{"movies:read", "users:admin"}, nil)
+
+			// JWT中只带有movies:read权限
+			token, err := app.newJWT(&data.User{ID: 7, Activated: true}, data.Permissions{"movies:read"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body := `{"name": "batch", "permissions": ` + tt.permissions + `, "expiry": ` + tt.expiry + `}`
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/api-keys", strings.NewReader(body))
+			r.Header.Set("Authorization", "Bearer "+token.Plaintext)
+			app.routes().ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("want status %d; got %d %s", tt.wantStatus, rr.Code, rr.Body)
+			}
+			insert, inserted := db.find("INSERT INTO api_keys (")
+			if tt.wantStatus != http.StatusCreated {
+				if inserted {
+					t.Error("want no key inserted")
+				}
+				return
+			}
+
+			var res struct {
+				APIKey struct {
+					ID  int64  `json:"id"`
+					Key string `json:"key"`
+				} `json:"api_key"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			v := validator.New()
+			if data.ValidateAPIKeyPlaintext(v, res.APIKey.Key); !v.Valid() {
+				t.Fatalf("want a valid plaintext key; got %q %v", res.APIKey.Key, v.Errors)
+			}
+			if !inserted {
+				t.Fatal("want the key inserted")
+			}
+			hash := sha256.Sum256([]byte(res.APIKey.Key))
+			if stored, ok := insert.args[0].([]byte); !ok || !bytes.Equal(stored, hash[:]) {
+				t.Error("want only the sha256 hash of the key stored")
+			}
+			if insert.args[1] != int64(7) || insert.args[2] != "batch" {
+				t.Errorf("unexpected insert args %v", insert.args)
+			}
+			if rr.Header().Get("Location") != "/v1/api-keys/1" {
+				t.Errorf("want Location of the new key; got %q", rr.Header().Get("Location"))
+			}
+			if _, ok := db.find("COMMIT"); !ok {
+				t.Error("want the key and its permissions committed together")
+			}
+		})
+	}
+}
+
+// TestRevokeAPIKey 测试只能吊销自己的密钥，其他用户的密钥返回404
+func TestRevokeAPIKey(t *testing.T) {
+	for _, found := range []bool{true, false} {
+		app, db := newAPIKeyTestApplication(t, []string{"movies:read"}, nil)
+		if !found {
+			db.noRows = "DELETE FROM api_keys"
+		}
+		token, err := app.newJWT(&data.User{ID: 7, Activated: true}, data.Permissions{"movies:read"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/v1/api-keys/4", nil)
+		r.Header.Set("Authorization", "Bearer "+token.Plaintext)
+		app.routes().ServeHTTP(rr, r)
+
+		wantStatus := http.StatusOK
+		if !found {
+			wantStatus = http.StatusNotFound
+		}
+		if rr.Code != wantStatus {
+			t.Fatalf("found=%v: want status %d; got %d %s", found, wantStatus, rr.Code, rr.Body)
+		}
+		del, ok := db.find("DELETE FROM api_keys")
+		if !ok || del.args[0] != int64(4) || del.args[1] != int64(7) {
+			t.Errorf("want the delete limited to the caller's key; got %+v", del)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	configFile "DesignMode/GreenLight/internal/config"
+	"DesignMode/GreenLight/internal/jsonlog"
+	"DesignMode/GreenLight/internal/jwt"
+	"DesignMode/GreenLight/internal/oidc"
+	"DesignMode/GreenLight/internal/realip"
+	"DesignMode/GreenLight/internal/redis"
+	"DesignMode/GreenLight/internal/validator"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TODO 该文件存储应用配置的定义、加载（默认值 < 配置文件 < GREENLIGHT_*环境变量 < 命令行参数）和校验
+
+// 配置结构体，用于存储服务器端口和环境变量。
+type config struct {
+	port            int           // 端口
+	env             string        // 环境
+	shutdownTimeout time.Duration // 优雅关闭等待请求和后台任务完成的最长时间
+	shutdownDelay   time.Duration // 收到关闭信号后就绪检查返回503、继续处理请求的时间，让负载均衡器摘除实例
+	logLevel        string        // 最小日志等级 (info|error|fatal|off)
+	// 可信代理（负载均衡器）的网段，只有来自这些地址的请求才读取X-Forwarded-For等请求头
+	trustedProxies   []string
+	trustedProxyNets realip.Proxies // 由validateConfig解析
+	// HTTPS配置，提供证书和私钥时启用
+	tls struct {
+		certFile              string        // PEM格式的证书（可以包含中间证书），文件变化时自动重新加载
+		keyFile               string        // PEM格式的私钥
+		redirectPort          int           // 将HTTP请求重定向到HTTPS的监听端口（0 不启用）
+		hstsMaxAge            time.Duration // Strict-Transport-Security的max-age（0 不发送）
+		hstsIncludeSubdomains bool          // HSTS是否包含子域名
+	}
+	// 就绪检查配置
+	healthcheck struct {
+		timeout time.Duration // 每项依赖检查的超时时间
+		smtp    bool          // 是否检查SMTP服务器的连通性
+	}
+	// 数据库相关配置信息，用于数据库连接池配置
+	db struct {
+		dsn             string
+		maxOpenConns    int
+		maxIdleConns    int
+		maxIdleTime     time.Duration
+		connMaxLifetime time.Duration
+	}
+	// 限流相关配置
+	limiter struct {
+		rps         float64
+		burst       int
+		enabled     bool
+		backend     string // 限流状态的存储 (memory|redis)，多实例部署时使用redis
+		redisURL    string // redis://[:password@]host[:port][/db]
+		redisPrefix string // Redis中限流key的前缀
+		// 各分组的限流策略 group=,rps=,burst=[,key=]，由validateConfig解析到policies
+		policySpecs []string
+		policies    map[string]rateLimitPolicy
+	}
+	// 跨域资源共享配置
+	cors struct {
+		trustedOrigins   []string      // 可信源列表
+		allowCredentials bool          // 是否允许携带凭证（Cookie、Authorization）
+		maxAge           time.Duration // 预检结果的缓存时间
+	}
+	// 邮件发送方式
+	mail struct {
+		transport       string        // 发送方式 (smtp|file|log)
+		outboxDir       string        // file发送方式写入.eml文件的目录
+		workers         int           // 投递发件箱邮件的worker数（0 本实例不投递）
+		pollInterval    time.Duration // 没有新邮件时检查到期邮件的间隔
+		maxAttempts     int           // 最大尝试次数，超过后标记为dead
+		retryBackoff    time.Duration // 第一次失败后的重试等待时间，之后每次翻倍
+		maxRetryBackoff time.Duration // 重试等待时间的上限
+		sendTimeout     time.Duration // 每次投递的超时时间
+		lease           time.Duration // 领取邮件的租约，超过后其他worker可以重新领取，必须远大于sendTimeout
+	}
+	// 邮件相关配置
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	// 登录暴力破解防护配置
+	lockout struct {
+		maxFailures   int           // 账户锁定前允许的失败次数
+		ipMaxFailures int           // IP锁定前允许的失败次数
+		baseDelay     time.Duration // 指数退避的初始时间
+		duration      time.Duration // 锁定时长
+	}
+	// 认证相关配置
+	auth struct {
+		mode string // 认证模式 (token|jwt)
+		jwt  struct {
+			alg      string        // 签名算法 (HS256|EdDSA)
+			keys     []string      // 密钥列表 kid:base64，第一个用于签发
+			issuer   string        // 签发者
+			audience string        // 受众
+			ttl      time.Duration // 有效期
+		}
+	}
+	// 社交登录（OpenID Connect）身份提供方
+	oauth struct {
+		specs     []string // 原始定义 name=,issuer=,...，由validateConfig解析到providers
+		providers []oidc.Config
+	}
+	// 分布式追踪配置
+	trace struct {
+		exporter     string  // 导出方式 (none|stdout|file|otlp)
+		file         string  // file导出方式写入的文件
+		otlpEndpoint string  // OTLP/HTTP接收地址
+		sampleRatio  float64 // 没有上游traceparent时的采样比例
+	}
+}
+
+// newConfigLoader 注册所有配置项及其默认值，配置项的key同时决定了配置文件中的位置、
+// 环境变量名和命令行参数名（如 db.max-open-conns、GREENLIGHT_DB_MAX_OPEN_CONNS、-db-max-open-conns）
+func newConfigLoader(cfg *config, fallback []byte) *configFile.Loader {
+	l := configFile.NewLoader("greenlight", fallback)
+
+	// TODO 端口和环境变量都可以在终端自定义
+	// go run ./cmd/api -port=3030 -env=production
+	l.Int(&cfg.port, "port", 4000, "API server port")
+	l.String(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	l.Duration(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Maximum time to wait for in-flight requests and background tasks on shutdown")
+	l.Duration(&cfg.shutdownDelay, "shutdown-delay", 0, "Time to keep serving with readiness failing after a shutdown signal, so load balancers stop routing first")
+	l.String(&cfg.logLevel, "log.level", "info", "Minimum log level (info|error|fatal|off), reloadable")
+	l.Fields(&cfg.trustedProxies, "trusted-proxies", nil, "Trusted proxy CIDRs or IPs (space separated) whose Forwarded, X-Forwarded-For and X-Real-IP headers are used for the client IP, reloadable")
+
+	// HTTPS配置
+	l.String(&cfg.tls.certFile, "tls.cert", "", "TLS certificate file (PEM), enables HTTPS and is reloaded when changed")
+	l.String(&cfg.tls.keyFile, "tls.key", "", "TLS private key file (PEM)")
+	l.Int(&cfg.tls.redirectPort, "tls.redirect-port", 0, "Port for a plain HTTP listener redirecting to HTTPS (0 to disable)")
+	l.Duration(&cfg.tls.hstsMaxAge, "tls.hsts-max-age", 0, "Strict-Transport-Security max-age sent over HTTPS (0 to disable)")
+	l.Bool(&cfg.tls.hstsIncludeSubdomains, "tls.hsts-include-subdomains", false, "Add includeSubDomains to the Strict-Transport-Security header")
+
+	// 就绪检查配置
+	l.Duration(&cfg.healthcheck.timeout, "healthcheck.timeout", 2*time.Second, "Timeout for each readiness dependency check")
+	l.Bool(&cfg.healthcheck.smtp, "healthcheck.smtp", false, "Include SMTP server reachability in readiness checks")
+
+	// 数据库连接池配置
+	l.String(&cfg.db.dsn, "db.dsn", "", "MySQL DSN").Secret()
+	l.Int(&cfg.db.maxOpenConns, "db.max-open-conns", 25, "MySQL max open connections (0 for unlimited)")
+	l.Int(&cfg.db.maxIdleConns, "db.max-idle-conns", 25, "MySQL max idle connections")
+	l.Duration(&cfg.db.maxIdleTime, "db.max-idle-time", 15*time.Minute, "MySQL max connection idle time")
+	l.Duration(&cfg.db.connMaxLifetime, "db.conn-max-lifetime", 0, "MySQL max connection lifetime (0 for unlimited)")
+
+	// 限流器配置
+	l.Float64(&cfg.limiter.rps, "limiter.rps", 2, "Rate limiter maximum requests per second, reloadable")
+	l.Int(&cfg.limiter.burst, "limiter.burst", 4, "Rate limiter maximum burst, reloadable")
+	l.Bool(&cfg.limiter.enabled, "limiter.enabled", true, "Enable rate limiter, reloadable")
+	l.List(&cfg.limiter.policySpecs, "limiter.policy", "Rate limit policy for a route group as group=default|auth|credentials,rps=,burst=[,key=ip|user] (repeatable), reloadable")
+	l.String(&cfg.limiter.backend, "limiter.backend", "memory", "Rate limiter backend (memory|redis), use redis to share limits between instances")
+	l.String(&cfg.limiter.redisURL, "limiter.redis-url", "redis://localhost:6379/0", "Redis URL for the redis rate limiter backend").Secret()
+	l.String(&cfg.limiter.redisPrefix, "limiter.redis-prefix", "greenlight:ratelimit:", "Key prefix for the redis rate limiter backend")
+
+	// 跨域资源共享配置
+	l.Fields(&cfg.cors.trustedOrigins, "cors.trusted-origins", nil, "Trusted CORS origins (space separated, supports * and https://*.example.com), reloadable")
+	l.Bool(&cfg.cors.allowCredentials, "cors.allow-credentials", false, "Allow credentialed CORS requests from trusted origins, reloadable")
+	l.Duration(&cfg.cors.maxAge, "cors.max-age", time.Hour, "How long browsers may cache CORS preflight results, reloadable")
+
+	// 邮件发送方式，默认只记录日志，不会向真实的邮箱发送邮件
+	l.String(&cfg.mail.transport, "mail.transport", "log", "Mail transport (smtp|file|log), file writes .eml files to mail.outbox-dir")
+	l.String(&cfg.mail.outboxDir, "mail.outbox-dir", "outbox", "Directory written by the file mail transport")
+	l.Int(&cfg.mail.workers, "mail.workers", 2, "Workers delivering queued emails (0 to disable delivery on this instance)")
+	l.Duration(&cfg.mail.pollInterval, "mail.poll-interval", 5*time.Second, "How often to check the email queue for due messages")
+	l.Int(&cfg.mail.maxAttempts, "mail.max-attempts", 8, "Delivery attempts before an email is dead-lettered")
+	l.Duration(&cfg.mail.retryBackoff, "mail.retry-backoff", 30*time.Second, "Wait after the first failed delivery, doubled on each failure")
+	l.Duration(&cfg.mail.maxRetryBackoff, "mail.max-retry-backoff", time.Hour, "Maximum wait between delivery attempts")
+	l.Duration(&cfg.mail.sendTimeout, "mail.send-timeout", 30*time.Second, "Timeout for delivering one email")
+	l.Duration(&cfg.mail.lease, "mail.lease", 2*time.Minute, "How long a claimed email is reserved for its worker, at least twice mail.send-timeout")
+
+	// 邮件服务器配置（smtp发送方式），账号密码通过环境变量或配置文件提供
+	l.String(&cfg.smtp.host, "smtp.host", "localhost", "SMTP host")
+	l.Int(&cfg.smtp.port, "smtp.port", 25, "SMTP port")
+	l.String(&cfg.smtp.username, "smtp.username", "", "SMTP username")
+	l.String(&cfg.smtp.password, "smtp.password", "", "SMTP password").Secret()
+	l.String(&cfg.smtp.sender, "smtp.sender", "Greenlight <no-reply@greenlight.alexedwards.net>", "SMTP sender")
+
+	// 登录暴力破解防护配置
+	l.Int(&cfg.lockout.maxFailures, "lockout.max-failures", 5, "Failed logins before an account is temporarily locked")
+	l.Int(&cfg.lockout.ipMaxFailures, "lockout.ip-max-failures", 20, "Failed logins before an IP address is temporarily locked")
+	l.Duration(&cfg.lockout.baseDelay, "lockout.base-delay", time.Second, "Backoff after the first failed login, doubled on each failure")
+	l.Duration(&cfg.lockout.duration, "lockout.duration", 15*time.Minute, "Lockout duration after too many failed logins")
+
+	// 认证配置
+	l.String(&cfg.auth.mode, "auth.mode", authModeToken, "Authentication mode (token|jwt)")
+	l.String(&cfg.auth.jwt.alg, "jwt.alg", jwt.AlgHS256, "JWT signing algorithm (HS256|EdDSA)")
+	l.Fields(&cfg.auth.jwt.keys, "jwt.keys", nil, "JWT keys as space separated kid:base64 pairs, the first one signs new tokens").Secret()
+	l.String(&cfg.auth.jwt.issuer, "jwt.issuer", "greenlight", "JWT issuer")
+	l.String(&cfg.auth.jwt.audience, "jwt.audience", "greenlight-api", "JWT audience")
+	l.Duration(&cfg.auth.jwt.ttl, "jwt.ttl", time.Hour, "JWT lifetime")
+
+	// 社交登录配置（可以重复指定多个身份提供方）
+	l.List(&cfg.oauth.specs, "oauth.provider", "OpenID Connect provider as name=,issuer=,client-id=,client-secret=,redirect-url=[,scopes=] (repeatable)").Secret()
+
+	// 分布式追踪配置（默认关闭）
+	l.String(&cfg.trace.exporter, "trace.exporter", "none", "Trace exporter (none|stdout|file|otlp)")
+	l.String(&cfg.trace.file, "trace.file", "traces.jsonl", "File written by the file trace exporter")
+	l.String(&cfg.trace.otlpEndpoint, "trace.otlp-endpoint", "http://localhost:4318/v1/traces", "OTLP/HTTP traces endpoint")
+	l.Float64(&cfg.trace.sampleRatio, "trace.sample-ratio", 1, "Fraction of new traces to sample (0-1)")
+
+	return l
+}
+
+// validateConfig 校验加载后的配置并解析社交登录的身份提供方，返回包含所有错误的error
+func validateConfig(cfg *config) error {
+	v := validator.New()
+
+	v.Check(cfg.port >= 0 && cfg.port <= 65535, "port", "must be between 0 and 65535")
+	v.Check(validator.In(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+	v.Check(cfg.shutdownTimeout > 0, "shutdown-timeout", "must be greater than zero")
+	v.Check(cfg.shutdownDelay >= 0, "shutdown-delay", "must not be negative")
+	v.Check(cfg.healthcheck.timeout > 0, "healthcheck.timeout", "must be greater than zero")
+	_, err := jsonlog.ParseLevel(cfg.logLevel)
+	v.Check(err == nil, "log.level", "must be info, error, fatal or off")
+	cfg.trustedProxyNets, err = realip.ParseProxies(cfg.trustedProxies)
+	if err != nil {
+		v.AddError("trusted-proxies", err.Error())
+	}
+
+	v.Check((cfg.tls.certFile == "") == (cfg.tls.keyFile == ""), "tls.key", "must be provided together with tls.cert")
+	if cfg.tls.redirectPort != 0 {
+		v.Check(cfg.tls.certFile != "", "tls.redirect-port", "requires tls.cert and tls.key")
+		v.Check(cfg.tls.redirectPort > 0 && cfg.tls.redirectPort <= 65535, "tls.redirect-port", "must be between 1 and 65535")
+		v.Check(cfg.tls.redirectPort != cfg.port, "tls.redirect-port", "must be different from port")
+	}
+	v.Check(cfg.tls.hstsMaxAge >= 0, "tls.hsts-max-age", "must not be negative")
+
+	v.Check(cfg.db.dsn != "", "db.dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns >= 0, "db.max-open-conns", "must not be negative")
+	v.Check(cfg.db.maxIdleConns >= 0, "db.max-idle-conns", "must not be negative")
+	v.Check(cfg.db.maxOpenConns == 0 || cfg.db.maxIdleConns <= cfg.db.maxOpenConns, "db.max-idle-conns", "must not be greater than db.max-open-conns")
+	v.Check(cfg.db.maxIdleTime >= 0, "db.max-idle-time", "must not be negative")
+	v.Check(cfg.db.connMaxLifetime >= 0, "db.conn-max-lifetime", "must not be negative")
+
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.rps > 0, "limiter.rps", "must be greater than zero")
+		v.Check(cfg.limiter.burst > 0, "limiter.burst", "must be greater than zero")
+	}
+	cfg.limiter.policies = defaultRateLimitPolicies(cfg.limiter.rps, cfg.limiter.burst)
+	for _, spec := range cfg.limiter.policySpecs {
+		group, policy, err := parseRateLimitPolicy(spec)
+		if err != nil {
+			v.AddError("limiter.policy", err.Error())
+			continue
+		}
+		cfg.limiter.policies[group] = policy
+	}
+	v.Check(validator.In(cfg.limiter.backend, "memory", "redis"), "limiter.backend", "must be memory or redis")
+	if cfg.limiter.backend == "redis" {
+		_, err := redis.ParseURL(cfg.limiter.redisURL)
+		v.Check(err == nil, "limiter.redis-url", "must be a valid redis:// URL")
+	}
+
+	v.Check(cfg.cors.maxAge >= 0, "cors.max-age", "must not be negative")
+	v.Check(!cfg.cors.allowCredentials || !validator.In("*", cfg.cors.trustedOrigins...), "cors.allow-credentials", "cannot be used with the * origin")
+
+	v.Check(validator.In(cfg.mail.transport, "smtp", "file", "log"), "mail.transport", "must be smtp, file or log")
+	v.Check(cfg.env != "production" || cfg.mail.transport == "smtp", "mail.transport", "must be smtp in production")
+	v.Check(cfg.mail.transport != "file" || cfg.mail.outboxDir != "", "mail.outbox-dir", "must be provided for the file transport")
+	v.Check(cfg.mail.workers >= 0, "mail.workers", "must not be negative")
+	v.Check(cfg.mail.pollInterval > 0, "mail.poll-interval", "must be greater than zero")
+	v.Check(cfg.mail.maxAttempts > 0, "mail.max-attempts", "must be greater than zero")
+	v.Check(cfg.mail.retryBackoff > 0, "mail.retry-backoff", "must be greater than zero")
+	v.Check(cfg.mail.maxRetryBackoff >= cfg.mail.retryBackoff, "mail.max-retry-backoff", "must not be less than mail.retry-backoff")
+	v.Check(cfg.mail.sendTimeout > 0, "mail.send-timeout", "must be greater than zero")
+	// 租约过期前投递必须已经结束，否则邮件会被其他worker重新领取并重复发送
+	v.Check(cfg.mail.lease >= 2*cfg.mail.sendTimeout, "mail.lease", "must be at least twice mail.send-timeout")
+	if cfg.mail.transport == "smtp" || cfg.healthcheck.smtp {
+		v.Check(cfg.smtp.host != "", "smtp.host", "must be provided")
+		v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp.port", "must be between 1 and 65535")
+	}
+	_, err = mail.ParseAddress(cfg.smtp.sender)
+	v.Check(err == nil, "smtp.sender", "must be a valid email address")
+	v.Check(cfg.smtp.password == "" || cfg.smtp.username != "", "smtp.username", "must be provided with smtp.password")
+
+	v.Check(cfg.lockout.maxFailures > 0, "lockout.max-failures", "must be greater than zero")
+	v.Check(cfg.lockout.ipMaxFailures > 0, "lockout.ip-max-failures", "must be greater than zero")
+	v.Check(cfg.lockout.baseDelay >= 0, "lockout.base-delay", "must not be negative")
+	v.Check(cfg.lockout.duration > 0, "lockout.duration", "must be greater than zero")
+
+	v.Check(validator.In(cfg.auth.mode, authModeToken, authModeJWT), "auth.mode", "must be token or jwt")
+	if cfg.auth.mode == authModeJWT {
+		v.Check(validator.In(cfg.auth.jwt.alg, jwt.AlgHS256, jwt.AlgEdDSA), "jwt.alg", "must be HS256 or EdDSA")
+		v.Check(len(cfg.auth.jwt.keys) > 0, "jwt.keys", "must be provided in jwt auth mode")
+		v.Check(cfg.auth.jwt.ttl > 0, "jwt.ttl", "must be greater than zero")
+	}
+
+	cfg.oauth.providers = nil
+	for _, spec := range cfg.oauth.specs {
+		provider, err := parseOAuthProvider(spec)
+		if err != nil {
+			v.AddError("oauth.provider", err.Error())
+			continue
+		}
+		cfg.oauth.providers = append(cfg.oauth.providers, provider)
+	}
+
+	v.Check(validator.In(cfg.trace.exporter, "none", "stdout", "file", "otlp"), "trace.exporter", "must be none, stdout, file or otlp")
+	v.Check(cfg.trace.exporter != "file" || cfg.trace.file != "", "trace.file", "must be provided for the file exporter")
+	v.Check(cfg.trace.exporter != "otlp" || cfg.trace.otlpEndpoint != "", "trace.otlp-endpoint", "must be provided for the otlp exporter")
+	v.Check(cfg.trace.sampleRatio >= 0 && cfg.trace.sampleRatio <= 1, "trace.sample-ratio", "must be between 0 and 1")
+
+	if v.Valid() {
+		return nil
+	}
+
+	keys := make([]string, 0, len(v.Errors))
+	for key := range v.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\n  %s: %s", key, v.Errors[key])
+	}
+	return fmt.Errorf("%s", b.String())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// loadTestConfig 使用内置配置文件和给定的命令行参数加载配置，不读取真实的环境变量
+func loadTestConfig(t *testing.T, args ...string) config {
+	t.Helper()
+
+	builtin, err := f.ReadFile("config/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg config
+	loader := newConfigLoader(&cfg, builtin)
+	loader.SetGetenv(func(string) string { return "" })
+	if err := loader.Load(args); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// TestValidateConfig 测试内置配置可以通过校验，以及各种无效配置的错误信息
+func TestValidateConfig(t *testing.T) {
+	cfg := loadTestConfig(t)
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("want built-in config to be valid; got %v", err)
+	}
+	if cfg.db.maxOpenConns != 100 || cfg.db.maxIdleConns != 10 || cfg.db.connMaxLifetime.Hours() != 1 {
+		t.Errorf("want db pool settings from the built-in config file; got %+v", cfg.db)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr []string
+	}{
+		{"invalid env", []string{"-env", "prod"}, []string{"env: must be development, staging or production"}},
+		{"jwt without keys", []string{"-auth-mode", "jwt"}, []string{"jwt.keys: must be provided"}},
+		{"idle greater than open", []string{"-db-max-open-conns", "5", "-db-max-idle-conns", "10"}, []string{"db.max-idle-conns"}},
+		{"tls key without cert", []string{"-tls-key", "key.pem"}, []string{"tls.key: must be provided together with tls.cert"}},
+		{"redirect without tls", []string{"-tls-redirect-port", "8080"}, []string{"tls.redirect-port: requires tls.cert and tls.key"}},
+		{"bad rate limit policy", []string{"-limiter-policy", "group=search,rps=1,burst=1"}, []string{"limiter.policy: unknown rate limit group"}},
+		{"bad trusted proxy", []string{"-trusted-proxies", "10.0.0.0/8 lb.internal"}, []string{"trusted-proxies: invalid proxy address"}},
+		{"unknown mail transport", []string{"-mail-transport", "sendmail"}, []string{"mail.transport: must be smtp, file or log"}},
+		{"mail lease shorter than send timeout", []string{"-mail-send-timeout", "1m", "-mail-lease", "90s"}, []string{"mail.lease: must be at least twice mail.send-timeout"}},
+		{"log mail in production", []string{"-env", "production", "-mail-transport", "log"}, []string{"mail.transport: must be smtp in production"}},
+		{"bad oauth provider", []string{"-oauth-provider", "name=x"}, []string{"oauth.provider"}},
+		{
+			"several errors",
+			[]string{"-db-dsn", "", "-trace-exporter", "jaeger", "-trace-sample-ratio", "2", "-smtp-sender", "nobody"},
+			[]string{"db.dsn: must be provided", "trace.exporter", "trace.sample-ratio", "smtp.sender"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, tt.args...)
+			err := validateConfig(&cfg)
+			if err == nil {
+				t.Fatal("want validation error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("want error containing %q; got %v", want, err)
+				}
+			}
+		})
+	}
+}
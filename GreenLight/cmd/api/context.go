@@ -0,0 +1,88 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"context"
+	"net/http"
+)
+
+// contextKey 自定义上下文key类型，避免与其他包的key冲突
+type contextKey string
+
+const (
+	// userContextKey 存放当前请求用户的key
+	userContextKey = contextKey("user")
+	// permissionsContextKey 存放当前请求凭证自带权限的key（JWT中的权限声明等）
+	permissionsContextKey = contextKey("permissions")
+	// requestInfoContextKey 存放请求ID等访问日志信息的key
+	requestInfoContextKey = contextKey("request_info")
+	// credentialContextKey 存放请求凭证标识的key（API密钥请求按密钥单独限流）
+	credentialContextKey = contextKey("credential")
+)
+
+// requestInfo 访问日志需要的请求信息。
+// 由最外层的logRequest中间件创建，内层中间件识别出用户后回填用户ID。
+type requestInfo struct {
+	id      string
+	userID  int64
+	traceID string // 请求被采样时由traceRequest回填
+}
+
+// contextSetUser 返回一个包含用户信息的新请求
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok && !user.IsAnonymous() {
+		info.userID = user.ID
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser 从请求上下文中取出用户信息，
+// 只有在authenticate中间件之后才会调用，因此取不到时直接panic
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// contextSetPermissions 返回一个包含凭证权限的新请求
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions 从请求上下文中取出凭证权限，不存在时返回false（需要查询数据库）
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+// contextSetCredential 返回一个包含凭证标识的新请求
+func (app *application) contextSetCredential(r *http.Request, credential string) *http.Request {
+	ctx := context.WithValue(r.Context(), credentialContextKey, credential)
+	return r.WithContext(ctx)
+}
+
+// contextGetCredential 从请求上下文中取出凭证标识，不存在时返回空字符串
+func (app *application) contextGetCredential(r *http.Request) string {
+	credential, _ := r.Context().Value(credentialContextKey).(string)
+	return credential
+}
+
+// contextSetRequestInfo 返回一个包含请求信息的新请求
+func (app *application) contextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID 从请求上下文中取出请求ID，不存在时返回空字符串
+func (app *application) contextGetRequestID(r *http.Request) string {
+	info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.id
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // TODO 通用错误error处理包
@@ -10,6 +13,7 @@ import (
 // 记录请求的方法和请求的URL。
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
+		"request_id":     app.contextGetRequestID(r),
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
@@ -20,6 +24,10 @@ func (app *application) logError(r *http.Request, err error) {
 // 注意，我们使用 interface{} 类型而不是字符串类型，这使得我们可以更灵活地处理响应中的值。
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
 	env := envelope{"error": message}
+	// 携带请求ID，方便客户端反馈问题时与日志对应
+	if id := app.contextGetRequestID(r); id != "" {
+		env["request_id"] = id
+	}
 
 	// 使用 writeJSON() 帮助函数写入响应。如果返回错误，则记录错误，并向客户端发送空的500内部服务器错误状态码。
 	err := app.writeJSON(w, status, env, nil)
@@ -67,12 +75,22 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
-// rateLimitExceedResponse 向客户端发送429太多请求状态码和JSON格式的错误消息。
-func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+// rateLimitExceedResponse 向客户端发送429太多请求状态码、Retry-After头和JSON格式的错误消息。
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
 	message := "rate limited exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+// tooManyLoginAttemptsResponse 向客户端发送429太多请求状态码、Retry-After头和JSON格式的错误消息。
+func (app *application) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 // invalidCredentialsResponse 向客户端发送401未授权状态码和JSON格式的错误消息。
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
@@ -81,7 +99,7 @@ func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *htt
 
 // invalidAuthenticationTokenResponse 向客户端发送401未授权状态码和"WWW-Authenticate: Bearer"头以及JSON格式的错误消息。
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("WWWW-Authenticate", "Bearer")
+	w.Header().Set("WWW-Authenticate", "Bearer")
 
 	message := "invalid or missing authentication token"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -105,3 +123,18 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+// apiKeyNotAllowedResponse 向客户端发送403禁止状态码和JSON格式的错误消息。
+// 管理API密钥和两步验证只能使用用户本人的凭证，不能使用API密钥
+func (app *application) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this resource cannot be accessed with an API key"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// oauthFailedResponse 社交登录失败时记录详细错误，并向客户端发送401未授权状态码和JSON格式的错误消息。
+func (app *application) oauthFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	message := "unable to sign in with the identity provider"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
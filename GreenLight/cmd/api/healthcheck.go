@@ -1,9 +1,16 @@
 package main
 
 import (
+	"DesignMode/GreenLight/internal/vcs"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // healthcheckHandler 是健康检查端点的处理函数。
@@ -67,8 +74,8 @@ func (app *application) healthcheckHandlerOld3(w http.ResponseWriter, r *http.Re
 	}
 }
 
-// healthcheckHandler 使用封装的writeJSON()函数来构建JSON，然后使用json.Marshal()函数来编码它。（使用统一的envelope作为统一响应数据结构）
-func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+// healthcheckHandlerOld4 使用封装的writeJSON()函数来构建JSON，然后使用json.Marshal()函数来编码它。（使用统一的envelope作为统一响应数据结构）
+func (app *application) healthcheckHandlerOld4(w http.ResponseWriter, r *http.Request) {
 	// Declare an envelope map containing the data for the response. Notice that the way
 	// we've constructed this means the environment and version data will now be nested
 	// under a system_info key in the JSON response.
@@ -88,3 +95,116 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// healthCheck 就绪检查的一项依赖检查
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthCheckResult 一项依赖检查的结果。
+// 就绪检查不需要认证，错误信息（地址、驱动错误等）只写入日志，不返回给客户端
+type healthCheckResult struct {
+	Status    string  `json:"status"` // up|down
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// newHealthChecks 返回就绪检查需要检查的依赖：数据库总是检查，SMTP服务器按配置检查（只检查TCP连通性）
+func (app *application) newHealthChecks(db *sql.DB) []healthCheck {
+	checks := []healthCheck{{name: "database", check: db.PingContext}}
+
+	if app.config.healthcheck.smtp {
+		addr := net.JoinHostPort(app.config.smtp.host, strconv.Itoa(app.config.smtp.port))
+		checks = append(checks, healthCheck{name: "smtp", check: func(ctx context.Context) error {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}})
+	}
+	return checks
+}
+
+// runHealthChecks 并发执行所有检查，每项检查的超时时间为healthcheck.timeout
+func (app *application) runHealthChecks(ctx context.Context) (map[string]healthCheckResult, bool) {
+	results := make(map[string]healthCheckResult, len(app.healthChecks))
+	healthy := true
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, hc := range app.healthChecks {
+		wg.Add(1)
+		go func(hc healthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, app.config.healthcheck.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := hc.check(ctx)
+			result := healthCheckResult{
+				Status:    "up",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "down"
+				app.logger.PrintError(err, map[string]string{"health_check": hc.name})
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[hc.name] = result
+			if err != nil {
+				healthy = false
+			}
+		}(hc)
+	}
+	wg.Wait()
+
+	return results, healthy
+}
+
+// livenessHandler 存活检查：进程能够处理请求即返回200，不检查依赖，
+// 依赖故障时不应该重启进程
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// healthcheckHandler 就绪检查（/v1/healthcheck 和 /v1/healthcheck/ready）：检查数据库等依赖并报告每项检查的状态和耗时。
+// 任意依赖不可用或服务正在优雅关闭时返回503，负载均衡器不再转发新的请求。
+func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	checks, healthy := app.runHealthChecks(r.Context())
+
+	status, code := "available", http.StatusOK
+	switch {
+	case app.draining.Load():
+		status, code = "draining", http.StatusServiceUnavailable
+	case !healthy:
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	build := vcs.Read(version)
+	env := envelope{
+		"status": status,
+		"system_info": map[string]interface{}{
+			"environment": app.config.env,
+			"version":     build.Version,
+			"commit":      build.Commit,
+			"dirty":       build.Dirty,
+			"build_time":  build.BuildTime,
+			"go_version":  build.GoVersion,
+		},
+		"checks": checks,
+	}
+	err := app.writeJSON(w, code, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/jsonlog"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestReadiness 测试就绪检查报告每项依赖的状态，依赖不可用或正在关闭时返回503，存活检查不受影响
+func TestReadiness(t *testing.T) {
+	var logs bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = jsonlog.NewLogger(&logs, jsonlog.LevelInfo)
+	app.config.healthcheck.timeout = 100 * time.Millisecond
+
+	var dbErr error
+	app.healthChecks = []healthCheck{
+		{name: "database", check: func(ctx context.Context) error { return dbErr }},
+		{name: "smtp", check: func(ctx context.Context) error {
+			<-ctx.Done() // 超时的检查
+			return ctx.Err()
+		}},
+	}
+
+	type response struct {
+		Status     string                       `json:"status"`
+		SystemInfo map[string]interface{}       `json:"system_info"`
+		Checks     map[string]healthCheckResult `json:"checks"`
+	}
+	var body []byte
+	get := func(handler http.HandlerFunc) (int, response) {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/v1/healthcheck/ready", nil))
+		body = rr.Body.Bytes()
+		var res response
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Code, res
+	}
+
+	code, res := get(app.healthcheckHandler)
+	if code != http.StatusServiceUnavailable || res.Status != "unavailable" {
+		t.Errorf("want 503 unavailable when smtp times out; got %d %s", code, res.Status)
+	}
+	if res.Checks["database"].Status != "up" || res.Checks["smtp"].Status != "down" {
+		t.Errorf("unexpected checks %+v", res.Checks)
+	}
+	if res.Checks["smtp"].LatencyMS < 100 {
+		t.Errorf("want smtp latency to include the timeout; got %v", res.Checks["smtp"].LatencyMS)
+	}
+	if res.SystemInfo["version"] != version || res.SystemInfo["go_version"] == "" {
+		t.Errorf("want build info in system_info; got %v", res.SystemInfo)
+	}
+
+	app.healthChecks = app.healthChecks[:1]
+	if code, res := get(app.healthcheckHandler); code != http.StatusOK || res.Status != "available" {
+		t.Errorf("want 200 available; got %d %s", code, res.Status)
+	}
+
+	// 错误详情只写入日志，不返回给匿名的调用方
+	logs.Reset()
+	dbErr = errors.New("dial tcp 10.0.0.5:3306: connection refused")
+	if code, res := get(app.healthcheckHandler); code != http.StatusServiceUnavailable || res.Checks["database"].Status != "down" {
+		t.Errorf("want database failure reported; got %d %+v", code, res.Checks)
+	}
+	if bytes.Contains(body, []byte("connection refused")) {
+		t.Errorf("want error details hidden from the response; got %s", body)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte("10.0.0.5:3306: connection refused")) || !bytes.Contains(logs.Bytes(), []byte(`"health_check":"database"`)) {
+		t.Errorf("want error details logged; got %s", logs.String())
+	}
+
+	dbErr = nil
+	app.draining.Store(true)
+	if code, res := get(app.healthcheckHandler); code != http.StatusServiceUnavailable || res.Status != "draining" {
+		t.Errorf("want 503 draining during shutdown; got %d %s", code, res.Status)
+	}
+	if code, res := get(app.livenessHandler); code != http.StatusOK || res.Status != "alive" {
+		t.Errorf("want liveness unaffected by draining; got %d %s", code, res.Status)
+	}
+}
+
+// TestSMTPHealthCheck 测试SMTP检查只在启用时加入，并检查服务器的TCP连通性
+func TestSMTPHealthCheck(t *testing.T) {
+	app := newTestApplication(t)
+	if checks := app.newHealthChecks(nil); len(checks) != 1 {
+		t.Fatalf("want only the database check by default; got %d", len(checks))
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config.healthcheck.smtp = true
+	app.config.smtp.host = "127.0.0.1"
+	app.config.smtp.port = ln.Addr().(*net.TCPAddr).Port
+	smtp := app.newHealthChecks(nil)[1]
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := smtp.check(ctx); err != nil {
+		t.Errorf("want reachable smtp server; got %v", err)
+	}
+
+	ln.Close()
+	if err := smtp.check(ctx); err == nil {
+		t.Errorf("want error after the smtp server on port %d stopped", app.config.smtp.port)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/realip"
 	"DesignMode/GreenLight/internal/validator"
 	"encoding/json"
 	"errors"
@@ -20,18 +22,29 @@ type envelope map[string]interface{}
 
 // readIDParam 读取路由中Id参数并返回
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+// readInt64Param 读取路由中指定名称的ID参数并返回
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	// 获取路由参数
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	// 如果出现错误或者id小于1，则返回错误
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
 }
 
+// readStringParam 读取路由中指定名称的字符串参数并返回
+func (app *application) readStringParam(r *http.Request, name string) string {
+	params := httprouter.ParamsFromContext(r.Context())
+	return params.ByName(name)
+}
+
 // writeJSONOld 使用json.Marshal 函数将数据编码为JSON格式，并返回一个包含JSON数据的字节切片。
 func (app *application) writeJSONOld(w http.ResponseWriter, status int, data interface{}, headers http.Header) error {
 	// 使用json.Marshal函数将数据marshal
@@ -196,13 +209,47 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readBool 读取查询字符串中的布尔值，未提供时返回nil
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	// 获取url中的key值
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	// 使用strconv.ParseBool函数将字符串转换为布尔值
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+	return &b
+}
+
+// audit 记录一条审计日志，写入失败时只记录错误，不影响已经完成的操作
+func (app *application) audit(r *http.Request, action, targetType string, targetID interface{}, details map[string]interface{}) {
+	entry := &data.AuditEntry{
+		ActorID:    app.contextGetUser(r).ID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		Details:    details,
+	}
+
+	err := app.models.WithContext(r.Context()).Audit.Insert(entry)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
 // background 函数用于在后台运行一个函数，并使用defer语句来处理任何可能的panic。
 func (app *application) background(fn func()) {
-	// 使用WaitGroup来等待后台goroutine完成
+	// 使用WaitGroup来等待后台goroutine完成，计数器用于在关闭超时时报告放弃的任务数
 	app.wg.Add(1)
+	app.backgroundTasks.Add(1)
 	go func() {
 		// defer语句会在函数返回之前执行
 		defer app.wg.Done()
+		defer app.backgroundTasks.Add(-1)
 		// recover处理任何可能的panic
 		defer func() {
 			if err := recover(); err != nil {
@@ -213,3 +260,9 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// clientIP 返回请求的客户端IP，请求经过可信代理时使用代理转发的地址（可信代理列表可以热加载）。
+// 限流、访问日志和登录锁定都使用它，保证同一个客户端在各处被识别为同一个IP。
+func (app *application) clientIP(r *http.Request) string {
+	return realip.FromRequest(r, app.liveConfig().trustedProxyNets)
+}
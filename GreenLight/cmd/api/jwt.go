@@ -0,0 +1,141 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/jwt"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 认证模式
+const (
+	authModeToken = "token" // 数据库令牌（默认）
+	authModeJWT   = "jwt"   // 无状态JWT
+)
+
+// jwtClaims 签发给客户端的JWT声明，包含用户ID（sub）、激活状态和权限
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Activated   bool             `json:"activated"`
+	Permissions data.Permissions `json:"permissions"`
+}
+
+// newJWTKeySet 根据配置创建JWT密钥集合。
+// 每个密钥的格式为 kid:base64，第一个密钥用于签发，其余密钥只用于校验（密钥轮换）。
+func newJWTKeySet(cfg config) (*jwt.KeySet, error) {
+	if len(cfg.auth.jwt.keys) == 0 {
+		return nil, errors.New("jwt auth mode requires at least one -jwt-keys entry")
+	}
+
+	var keys []*jwt.Key
+	for _, spec := range cfg.auth.jwt.keys {
+		id, encoded, found := strings.Cut(spec, ":")
+		if !found || id == "" {
+			return nil, fmt.Errorf("invalid jwt key %q: expected kid:base64", spec)
+		}
+		material, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt key %q: %w", id, err)
+		}
+
+		var key *jwt.Key
+		switch cfg.auth.jwt.alg {
+		case jwt.AlgHS256:
+			key, err = jwt.NewHMACKey(id, material)
+		case jwt.AlgEdDSA:
+			key, err = jwt.NewEd25519Key(id, material)
+		default:
+			err = fmt.Errorf("unsupported jwt algorithm %q", cfg.auth.jwt.alg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return jwt.NewKeySet(keys[0], keys[1:]...), nil
+}
+
+// newJWT 为用户签发一个JWT，并以data.Token的形式返回，保持与数据库令牌相同的响应结构
+func (app *application) newJWT(user *data.User, permissions data.Permissions) (*data.Token, error) {
+	now := time.Now()
+	expiry := now.Add(app.config.auth.jwt.ttl)
+
+	claims := jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    app.config.auth.jwt.issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.Audience{app.config.auth.jwt.audience},
+			ExpiresAt: expiry.Unix(),
+			NotBefore: now.Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Activated:   user.Activated,
+		Permissions: permissions,
+	}
+
+	signed, err := app.jwtKeys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{
+		Plaintext: signed,
+		UserID:    user.ID,
+		Expiry:    expiry,
+		Scope:     data.ScopeAuthentication,
+	}, nil
+}
+
+// parseJWT 校验JWT的签名、过期时间、签发者和受众（不访问数据库），
+// 并返回声明中的用户和权限
+func (app *application) parseJWT(token string) (*data.User, data.Permissions, error) {
+	var claims jwtClaims
+	err := app.jwtKeys.Parse(token, &claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = claims.Validate(time.Now(), app.config.auth.jwt.issuer, app.config.auth.jwt.audience)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || id < 1 {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	user := &data.User{
+		ID:        id,
+		Activated: claims.Activated,
+	}
+
+	return user, claims.Permissions, nil
+}
+
+// jwksHandler 发布JWT的公钥（GET /.well-known/jwks.json），边缘服务等校验方通过该接口获取公钥离线校验令牌。
+// 轮换中的旧密钥也会被发布，直到从jwt.keys中移除；HS256密钥没有公钥，返回空的keys。
+// 非jwt认证模式下返回404。
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	if app.config.auth.mode != authModeJWT || app.jwtKeys == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	jwks := app.jwtKeys.PublicJWKS()
+
+	// 允许校验方缓存一段时间，轮换密钥时新密钥应提前加入jwt.keys
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"keys": jwks.Keys}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/jwt"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestJWKSHandler 测试 GET /.well-known/jwks.json 发布的公钥可以校验签发的令牌，并且不发布HS256密钥
+func TestJWKSHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.auth.mode = authModeJWT
+	app.config.auth.jwt.ttl = time.Hour
+
+	signing, err := jwt.NewEd25519Key("e2", bytes.Repeat([]byte("e"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 轮换中的旧密钥
+	previous, err := jwt.NewEd25519Key("e1", bytes.Repeat([]byte("p"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := jwt.NewHMACKey("h1", bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.jwtKeys = jwt.NewKeySet(signing, previous, secret)
+
+	token, err := app.newJWT(&data.User{ID: 7, Activated: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := app.routes()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d; got %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("Cache-Control"); got == "" {
+		t.Error("want Cache-Control header")
+	}
+
+	body, err := io.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(body, []byte(`"h1"`)) {
+		t.Errorf("HS256 key must not be published: %s", body)
+	}
+	if !bytes.Contains(body, []byte(`"e1"`)) {
+		t.Errorf("want rotated key e1 in JWKS: %s", body)
+	}
+
+	verifier, err := jwt.ParseJWKS(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims jwtClaims
+	if err := verifier.Parse(token.Plaintext, &claims); err != nil {
+		t.Fatalf("token does not verify with published keys: %v", err)
+	}
+	if claims.Subject != "7" {
+		t.Errorf("want subject 7; got %q", claims.Subject)
+	}
+
+	// 数据库令牌模式下没有公钥可以发布
+	app.config.auth.mode = authModeToken
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d in token mode; got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginAttempts 记录一个账户或一个IP的登录失败情况
+type loginAttempts struct {
+	failures     int       // 窗口内连续失败次数
+	lastFailure  time.Time // 最后一次失败时间
+	blockedUntil time.Time // 在此时间之前拒绝新的登录尝试
+}
+
+// loginGuard 登录暴力破解防护，分别按账户和按IP统计失败次数。
+// 每次失败后按指数退避拒绝后续尝试，失败次数达到上限后临时锁定。
+// 只保存在进程内存中（与使用memory后端的rateLimit相同）。
+type loginGuard struct {
+	mu       sync.Mutex
+	accounts map[string]*loginAttempts
+	ips      map[string]*loginAttempts
+
+	maxAccountFailures int           // 账户锁定前允许的失败次数
+	maxIPFailures      int           // IP锁定前允许的失败次数
+	baseDelay          time.Duration // 第一次失败后的退避时间，之后每次翻倍
+	lockout            time.Duration // 锁定时长，同时也是失败计数的统计窗口
+
+	now func() time.Time
+}
+
+// newLoginGuard 创建登录防护，并启动一个goroutine清理过期的记录
+func newLoginGuard(maxAccountFailures, maxIPFailures int, baseDelay, lockout time.Duration) *loginGuard {
+	g := &loginGuard{
+		accounts:           make(map[string]*loginAttempts),
+		ips:                make(map[string]*loginAttempts),
+		maxAccountFailures: maxAccountFailures,
+		maxIPFailures:      maxIPFailures,
+		baseDelay:          baseDelay,
+		lockout:            lockout,
+		now:                time.Now,
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			g.cleanup()
+		}
+	}()
+
+	return g
+}
+
+// allow 判断是否允许这次登录尝试，返回需要等待的时间，0表示允许
+func (g *loginGuard) allow(email, ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	wait := g.wait(g.accounts[accountKey(email)], now)
+	if ipWait := g.wait(g.ips[ip], now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait
+}
+
+// fail 记录一次登录失败，返回账户是否因为这次失败而被锁定
+func (g *loginGuard) fail(email, ip string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	locked := g.record(g.accounts, accountKey(email), g.maxAccountFailures, now)
+	g.record(g.ips, ip, g.maxIPFailures, now)
+	return locked
+}
+
+// succeed 登录成功后清除账户的失败记录。
+// IP的失败记录保留，避免攻击者用自己的账户登录来重置IP计数。
+func (g *loginGuard) succeed(email string) {
+	g.reset(email)
+}
+
+// reset 清除账户的失败记录和锁定状态（登录成功或重置密码时调用）
+func (g *loginGuard) reset(email string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.accounts, accountKey(email))
+}
+
+// wait 计算还需要等待的时间
+func (g *loginGuard) wait(attempts *loginAttempts, now time.Time) time.Duration {
+	if attempts == nil || !now.Before(attempts.blockedUntil) {
+		return 0
+	}
+	return attempts.blockedUntil.Sub(now)
+}
+
+// record 记录一次失败并计算退避时间，返回是否在这次失败时进入锁定状态
+func (g *loginGuard) record(records map[string]*loginAttempts, key string, maxFailures int, now time.Time) bool {
+	attempts, found := records[key]
+	// 超出统计窗口的失败次数重新计数
+	if !found || now.Sub(attempts.lastFailure) > g.lockout {
+		attempts = &loginAttempts{}
+		records[key] = attempts
+	}
+
+	attempts.failures++
+	attempts.lastFailure = now
+
+	if attempts.failures >= maxFailures {
+		attempts.blockedUntil = now.Add(g.lockout)
+		return attempts.failures == maxFailures
+	}
+
+	// 指数退避：baseDelay * 2^(failures-1)，最长不超过锁定时长
+	delay := g.baseDelay << uint(attempts.failures-1)
+	if delay <= 0 || delay > g.lockout {
+		delay = g.lockout
+	}
+	attempts.blockedUntil = now.Add(delay)
+	return false
+}
+
+// cleanup 删除已经解锁并且超出统计窗口的记录
+func (g *loginGuard) cleanup() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for _, records := range []map[string]*loginAttempts{g.accounts, g.ips} {
+		for key, attempts := range records {
+			if now.After(attempts.blockedUntil) && now.Sub(attempts.lastFailure) > g.lockout {
+				delete(records, key)
+			}
+		}
+	}
+}
+
+// accountKey 邮箱不区分大小写
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
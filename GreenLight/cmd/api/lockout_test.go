@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestLoginGuard 创建一个使用可控时钟的登录防护（不启动清理goroutine）
+func newTestLoginGuard(now *time.Time) *loginGuard {
+	return &loginGuard{
+		accounts:           make(map[string]*loginAttempts),
+		ips:                make(map[string]*loginAttempts),
+		maxAccountFailures: 3,
+		maxIPFailures:      5,
+		baseDelay:          time.Second,
+		lockout:            time.Minute,
+		now:                func() time.Time { return *now },
+	}
+}
+
+// TestLoginGuardBackoffAndLockout 测试指数退避和达到上限后的锁定
+func TestLoginGuardBackoffAndLockout(t *testing.T) {
+	now := time.Now()
+	g := newTestLoginGuard(&now)
+
+	if wait := g.allow("alice@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("want no wait before any failure; got %s", wait)
+	}
+
+	// 第一次失败后退避1秒，第二次失败后退避2秒
+	for i, want := range []time.Duration{time.Second, 2 * time.Second} {
+		if locked := g.fail("alice@example.com", "10.0.0.1"); locked {
+			t.Fatalf("failure %d: account locked too early", i+1)
+		}
+		if wait := g.allow("ALICE@example.com", "10.0.0.2"); wait != want {
+			t.Errorf("failure %d: want wait %s; got %s", i+1, want, wait)
+		}
+		now = now.Add(want)
+	}
+
+	// 第三次失败后锁定，并且只报告一次
+	if locked := g.fail("alice@example.com", "10.0.0.1"); !locked {
+		t.Fatal("want account to be locked after max failures")
+	}
+	if wait := g.allow("alice@example.com", "10.0.0.2"); wait != time.Minute {
+		t.Errorf("want lockout wait %s; got %s", time.Minute, wait)
+	}
+
+	// 锁定结束后可以再次尝试，并且重新计数
+	now = now.Add(time.Minute + time.Second)
+	if wait := g.allow("alice@example.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("want no wait after lockout expired; got %s", wait)
+	}
+	if locked := g.fail("alice@example.com", "10.0.0.2"); locked {
+		t.Error("want failure counter to restart after lockout window")
+	}
+}
+
+// TestLoginGuardPerIP 测试同一个IP对多个账户的猜测会被IP计数拦截
+func TestLoginGuardPerIP(t *testing.T) {
+	now := time.Now()
+	g := newTestLoginGuard(&now)
+
+	for i := 0; i < 5; i++ {
+		g.fail(fmt.Sprintf("user%d@example.com", i), "10.0.0.9")
+		now = now.Add(30 * time.Second) // 超过单个账户的退避时间
+	}
+
+	if wait := g.allow("new@example.com", "10.0.0.9"); wait == 0 {
+		t.Error("want IP to be locked after max IP failures")
+	}
+	if wait := g.allow("new@example.com", "10.0.0.10"); wait != 0 {
+		t.Errorf("want other IPs to be unaffected; got %s", wait)
+	}
+}
+
+// TestLoginGuardReset 测试登录成功或重置密码后解除锁定
+func TestLoginGuardReset(t *testing.T) {
+	now := time.Now()
+	g := newTestLoginGuard(&now)
+
+	for i := 0; i < 3; i++ {
+		g.fail("bob@example.com", "10.0.0.1")
+	}
+	if wait := g.allow("bob@example.com", "10.0.0.2"); wait == 0 {
+		t.Fatal("want account to be locked")
+	}
+
+	g.reset("Bob@Example.com")
+
+	if wait := g.allow("bob@example.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("want lockout cleared after reset; got %s", wait)
+	}
+}
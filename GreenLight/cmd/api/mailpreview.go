@@ -0,0 +1,84 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/mailer"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TODO 该文件存储 -mail-preview 命令：使用示例数据渲染邮件模板，不需要数据库和邮件服务器
+
+// mailPreviewData 每个邮件模板的示例数据，字段与发送邮件时传入的数据一致
+var mailPreviewData = map[string]map[string]interface{}{
+	"user_welcome.tmpl": {
+		"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"userID":          42,
+	},
+	"token_password_reset.tmpl": {
+		"passwordResetToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+	},
+	"account_locked.tmpl": {
+		"ip":             "203.0.113.7",
+		"lockoutMinutes": 15,
+	},
+}
+
+// previewMail 使用示例数据渲染templateFile（可以省略.tmpl）在language下的版本。
+// out为空时将主题、纯文本正文和HTML正文输出到stdout；out以.html结尾时只写入HTML正文，便于在浏览器中查看。
+func previewMail(stdout io.Writer, sender, templateFile, language, out string) error {
+	m, err := mailer.New(nil, sender)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasSuffix(templateFile, ".tmpl") {
+		templateFile += ".tmpl"
+	}
+	sample, ok := mailPreviewData[templateFile]
+	if !ok {
+		return fmt.Errorf("no sample data for email template %q (available: %s)", templateFile, strings.Join(m.Templates(), ", "))
+	}
+
+	lang, ok := mailer.ParseLanguage(language)
+	if !ok {
+		return fmt.Errorf("unsupported language %q (available: %s)", language, strings.Join(mailer.Languages(), ", "))
+	}
+
+	msg, err := m.Render(lang, templateFile, sample)
+	if err != nil {
+		return err
+	}
+
+	if filepath.Ext(out) == ".html" {
+		return os.WriteFile(out, []byte(msg.HTMLBody), 0o644)
+	}
+
+	if out == "" {
+		return writeMailPreview(stdout, msg)
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	err = writeMailPreview(file, msg)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeMailPreview 输出邮件的发件人、主题、内嵌图片、纯文本正文和HTML正文
+func writeMailPreview(w io.Writer, msg *mailer.Message) error {
+	header := fmt.Sprintf("From: %s\nSubject: %s\n", msg.From, msg.Subject)
+	for _, a := range msg.Inline {
+		header += fmt.Sprintf("Inline: %s (%d bytes)\n", a.Filename, len(a.Data))
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n--- text/plain ---\n%s\n--- text/html ---\n%s\n",
+		header, msg.PlainBody, msg.HTMLBody)
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/mailer"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMailPreview 测试每个邮件模板都有示例数据，并且可以在所有语言下渲染
+func TestMailPreview(t *testing.T) {
+	m := newTestMailer(t, nil, "no-reply@greenlight.test")
+	for _, name := range m.Templates() {
+		for _, language := range mailer.Languages() {
+			var out bytes.Buffer
+			if err := previewMail(&out, "no-reply@greenlight.test", name, language, ""); err != nil {
+				t.Errorf("%s (%s): %v", name, language, err)
+				continue
+			}
+			if !strings.Contains(out.String(), "Subject: ") || strings.Contains(out.String(), "<no value>") {
+				t.Errorf("%s (%s): unexpected preview %s", name, language, out.String())
+			}
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "welcome.html")
+	if err := previewMail(nil, "no-reply@greenlight.test", "user_welcome", "zh-CN", file); err != nil {
+		t.Fatal(err)
+	}
+	html, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(html), []byte("<!doctype html>")) || !bytes.Contains(html, []byte("Y3QMGX3PJ3WLRL2YRTQGQ6KRHU")) {
+		t.Errorf("want only the HTML body with the sample token; got %s", html)
+	}
+
+	if err := previewMail(nil, "no-reply@greenlight.test", "newsletter", "en", ""); err == nil || !strings.Contains(err.Error(), "user_welcome.tmpl") {
+		t.Errorf("want error listing available templates; got %v", err)
+	}
+	if err := previewMail(nil, "no-reply@greenlight.test", "user_welcome", "fr", ""); err == nil {
+		t.Error("want error for an unsupported language")
+	}
+}
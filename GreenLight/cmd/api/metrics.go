@@ -0,0 +1,235 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/metrics"
+	"database/sql"
+	"expvar"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TODO 该文件存储应用指标的采集中间件和输出接口（/debug/vars 和 /metrics）
+
+// appMetrics 应用指标
+type appMetrics struct {
+	registry *metrics.Registry
+
+	requests    *metrics.Counter      // 收到的请求总数
+	responses   *metrics.CounterVec   // 按状态码统计的响应数
+	inFlight    *metrics.Gauge        // 正在处理的请求数
+	duration    *metrics.HistogramVec // 按路由统计的处理时间
+	rateLimited *metrics.Counter      // 被限流拒绝的请求数
+	mailQueued  *metrics.Counter      // 写入发件箱的邮件数
+	mailSent    *metrics.Counter      // 发送成功的邮件数
+	mailFailed  *metrics.Counter      // 发送失败的次数（包括之后重试成功的）
+	mailDead    *metrics.Counter      // 达到最大尝试次数、不再自动重试的邮件数
+}
+
+// newAppMetrics 创建应用指标，db不为nil时同时采集数据库连接池的统计数据
+func newAppMetrics(db *sql.DB) *appMetrics {
+	r := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry:    r,
+		requests:    r.NewCounter("greenlight_http_requests_total", "Total number of HTTP requests received."),
+		responses:   r.NewCounterVec("greenlight_http_responses_total", "Total number of HTTP responses sent, by status code.", "status"),
+		inFlight:    r.NewGauge("greenlight_http_requests_in_flight", "Number of HTTP requests currently being processed."),
+		duration:    r.NewHistogramVec("greenlight_http_request_duration_seconds", "HTTP request processing time, by method and route pattern.", metrics.DefBuckets, "method", "route"),
+		rateLimited: r.NewCounter("greenlight_rate_limited_total", "Total number of requests rejected by the rate limiter."),
+		mailQueued:  r.NewCounter("greenlight_mail_queued_total", "Total number of emails written to the outbox."),
+		mailSent:    r.NewCounter("greenlight_mail_sent_total", "Total number of emails sent."),
+		mailFailed:  r.NewCounter("greenlight_mail_failed_total", "Total number of failed email delivery attempts."),
+		mailDead:    r.NewCounter("greenlight_mail_dead_total", "Total number of emails dead-lettered after too many failed attempts."),
+	}
+
+	r.NewGaugeFunc("greenlight_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+
+	if db != nil {
+		r.NewGaugeFunc("greenlight_db_open_connections", "Number of established database connections.", func() float64 {
+			return float64(db.Stats().OpenConnections)
+		})
+		r.NewGaugeFunc("greenlight_db_in_use_connections", "Number of database connections currently in use.", func() float64 {
+			return float64(db.Stats().InUse)
+		})
+		r.NewGaugeFunc("greenlight_db_idle_connections", "Number of idle database connections.", func() float64 {
+			return float64(db.Stats().Idle)
+		})
+		r.NewCounterFunc("greenlight_db_wait_count_total", "Total number of times a database connection was waited for.", func() float64 {
+			return float64(db.Stats().WaitCount)
+		})
+		r.NewCounterFunc("greenlight_db_wait_duration_seconds_total", "Total time spent waiting for a database connection.", func() float64 {
+			return db.Stats().WaitDuration.Seconds()
+		})
+		r.NewCounterFunc("greenlight_db_max_idle_closed_total", "Total number of connections closed due to max idle connections.", func() float64 {
+			return float64(db.Stats().MaxIdleClosed)
+		})
+		r.NewCounterFunc("greenlight_db_max_idle_time_closed_total", "Total number of connections closed due to max idle time.", func() float64 {
+			return float64(db.Stats().MaxIdleTimeClosed)
+		})
+	}
+
+	return m
+}
+
+// metricsResponseWriter 包装http.ResponseWriter，记录响应状态码和写入的字节数
+type metricsResponseWriter struct {
+	wrapped       http.ResponseWriter
+	statusCode    int
+	bytes         int
+	headerWritten bool
+}
+
+func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
+	return &metricsResponseWriter{
+		wrapped:    w,
+		statusCode: http.StatusOK,
+	}
+}
+
+func (mw *metricsResponseWriter) Header() http.Header {
+	return mw.wrapped.Header()
+}
+
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	mw.wrapped.WriteHeader(statusCode)
+
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+}
+
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	n, err := mw.wrapped.Write(b)
+	mw.bytes += n
+	return n, err
+}
+
+// Unwrap 让http.ResponseController可以访问底层的ResponseWriter
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.wrapped
+}
+
+// collectMetrics 创建中间件collectMetrics，统计请求数、响应状态码、处理时间和正在处理的请求数。
+// 处理时间按路由模式（如 /v1/movies/:id）而不是实际路径统计，避免标签数量无限增长。
+func (app *application) collectMetrics(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		app.metrics.requests.Inc()
+		app.metrics.inFlight.Add(1)
+		defer app.metrics.inFlight.Add(-1)
+
+		mw := newMetricsResponseWriter(w)
+		next.ServeHTTP(mw, r)
+
+		app.metrics.responses.With(strconv.Itoa(mw.statusCode)).Inc()
+
+		method, route := routeLabels(router, r)
+		app.metrics.duration.With(method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeLabels 返回请求对应的方法和路由模式，未匹配到路由的请求统一归为 unmatched
+func routeLabels(router *patternRouter, r *http.Request) (string, string) {
+	route := routePattern(router, r)
+	if route == "" {
+		return "OTHER", "unmatched"
+	}
+	return r.Method, route
+}
+
+// patternRouter 在httprouter.Router的基础上记录每个方法注册的路由模式。
+// httprouter v1.3 不会保存匹配到的路由，routePattern需要根据注册的路由模式还原。
+type patternRouter struct {
+	*httprouter.Router
+	patterns map[string][]string
+}
+
+// newPatternRouter 创建一个patternRouter
+func newPatternRouter() *patternRouter {
+	return &patternRouter{Router: httprouter.New(), patterns: make(map[string][]string)}
+}
+
+// Handle 注册路由并记录路由模式
+func (router *patternRouter) Handle(method, path string, handle httprouter.Handle) {
+	router.Router.Handle(method, path, handle)
+	router.patterns[method] = append(router.patterns[method], path)
+}
+
+// Handler 注册路由并记录路由模式
+func (router *patternRouter) Handler(method, path string, handler http.Handler) {
+	router.Router.Handler(method, path, handler)
+	router.patterns[method] = append(router.patterns[method], path)
+}
+
+// HandlerFunc 注册路由并记录路由模式
+func (router *patternRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	router.Handler(method, path, handler)
+}
+
+// routePattern 通过路由器查找请求匹配的路由，返回注册时的路由模式，未匹配时返回空字符串
+func routePattern(router *patternRouter, r *http.Request) string {
+	handle, params, _ := router.Lookup(r.Method, r.URL.Path)
+	if handle == nil {
+		return ""
+	}
+	if len(params) == 0 {
+		return r.URL.Path
+	}
+
+	// httprouter保证同一个方法下最多只有一个路由模式与路径的静态部分和参数按位置对应
+	segments := strings.Split(r.URL.Path, "/")
+	for _, pattern := range router.patterns[r.Method] {
+		if matchRoutePattern(pattern, segments, params) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// matchRoutePattern 判断路由模式的每一段是否与路径对应位置的段匹配：静态段必须相同，
+// 参数段（:name）必须是params中的下一个参数，通配段（*name）匹配剩余的全部路径
+func matchRoutePattern(pattern string, segments []string, params httprouter.Params) bool {
+	parts := strings.Split(pattern, "/")
+	next := 0
+	for i, part := range parts {
+		if i >= len(segments) {
+			return false
+		}
+		switch {
+		case strings.HasPrefix(part, ":"):
+			if next >= len(params) || params[next].Key != part[1:] || params[next].Value != segments[i] {
+				return false
+			}
+			next++
+		case strings.HasPrefix(part, "*"):
+			return next == len(params)-1 && params[next].Key == part[1:]
+		case part != segments[i]:
+			return false
+		}
+	}
+	return len(parts) == len(segments) && next == len(params)
+}
+
+// 输出expvar格式的指标 expvarHandler（包括Go运行时的memstats）
+func (app *application) expvarHandler(w http.ResponseWriter, r *http.Request) {
+	expvar.Handler().ServeHTTP(w, r)
+}
+
+// 输出Prometheus文本格式的指标 prometheusHandler
+func (app *application) prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	err := app.metrics.registry.WritePrometheus(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRoutePattern 测试返回注册时的路由模式，参数按位置对应，参数值与静态段相同时也不会混淆
+func TestRoutePattern(t *testing.T) {
+	router := newPatternRouter()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", noop)
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role_id", noop)
+	router.HandlerFunc(http.MethodGet, "/v1/movies", noop)
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/:provider/callback", noop)
+	router.HandlerFunc(http.MethodGet, "/static/*filepath", noop)
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/v1/movies/42", "/v1/movies/:id"},
+		{http.MethodDelete, "/v1/admin/users/7/roles/3", "/v1/admin/users/:id/roles/:role_id"},
+		{http.MethodGet, "/v1/movies", "/v1/movies"},
+		{http.MethodGet, "/v1/oauth/v1/callback", "/v1/oauth/:provider/callback"},
+		{http.MethodGet, "/v1/oauth/oauth/callback", "/v1/oauth/:provider/callback"},
+		{http.MethodDelete, "/v1/admin/users/3/roles/3", "/v1/admin/users/:id/roles/:role_id"},
+		{http.MethodDelete, "/v1/admin/users/users/roles/roles", "/v1/admin/users/:id/roles/:role_id"},
+		{http.MethodGet, "/static/css/app.css", "/static/*filepath"},
+		{http.MethodPost, "/v1/movies/42", ""},
+		{http.MethodGet, "/v1/unknown", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := routePattern(router, r); got != tt.want {
+			t.Errorf("%s %s: want %q; got %q", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+// TestCollectMetrics 测试请求指标的采集，以及指标接口需要认证
+func TestCollectMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.routes()
+
+	for _, path := range []string{"/v1/does-not-exist", "/metrics", "/debug/vars"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if path != "/v1/does-not-exist" && rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: want status %d for anonymous user; got %d", path, http.StatusUnauthorized, rr.Code)
+		}
+	}
+
+	if got := app.metrics.requests.Value(); got != 3 {
+		t.Errorf("want 3 requests; got %d", got)
+	}
+	if got := app.metrics.responses.With("401").Value(); got != 2 {
+		t.Errorf("want 2 responses with status 401; got %d", got)
+	}
+	if got := app.metrics.inFlight.Value(); got != 0 {
+		t.Errorf("want 0 requests in flight; got %d", got)
+	}
+
+	var out strings.Builder
+	if err := app.metrics.registry.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`greenlight_http_request_duration_seconds_count{method="GET",route="/metrics"} 1`,
+		`greenlight_http_request_duration_seconds_count{method="OTHER",route="unmatched"} 1`,
+		`greenlight_http_responses_total{status="404"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want output to contain %q", want)
+		}
+	}
+}
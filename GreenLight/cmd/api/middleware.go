@@ -1,10 +1,19 @@
 package main
 
 import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/ratelimit"
+	"DesignMode/GreenLight/internal/trace"
+	"DesignMode/GreenLight/internal/validator"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"golang.org/x/time/rate"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -36,7 +45,7 @@ func (app *application) rateLimitOld0(next http.Handler) http.Handler {
 		// 如果请求速率超出了限制，则调用rateLimitExceededResponse函数，并返回。
 		// Allow（）方法是由互斥锁保护，并且对于并发使用是安全的！
 		if !limiter.Allow() {
-			app.rateLimitExceededResponse(w, r)
+			app.rateLimitExceededResponse(w, r, time.Second) // 速率为2个请求/秒，1秒内一定可以取得令牌
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -67,7 +76,7 @@ func (app *application) rateLimitOld1(next http.Handler) http.Handler {
 		// 如果对应IP的请求速率超出了限制，则调用rateLimitExceededResponse函数，并返回。
 		if !clients[ip].Allow() {
 			mu.Unlock()
-			app.rateLimitExceededResponse(w, r)
+			app.rateLimitExceededResponse(w, r, time.Second) // 速率为2个请求/秒，1秒内一定可以取得令牌
 			return
 		}
 		// 释放互斥锁
@@ -76,67 +85,425 @@ func (app *application) rateLimitOld1(next http.Handler) http.Handler {
 	})
 }
 
-// 创建个中间件rateLimit，用于限制请求速率（其中包含对应IP地址限制和IP存活时间限制）
-// （这种reteLimit只能作用于单台机器的情况，若为分布式情况，则无法适应）
-// 当为分布式系统时，我们应该使用HAProxy或Nginx作为负载均衡器或反向代理，它们都有内置的速率限制功能！
-func (app *application) rateLimit(next http.Handler) http.Handler {
-	// 初始化一个结构体，用于存储IP地址和对应的rate.Limiter对象和最后使用时间。
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
+// 创建个中间件rateLimit，用于按策略限制请求速率
+// 路由按rateLimitGroups分组，每个分组有自己的配额和计数方式（按用户、API密钥或IP），
+// 因此需要放在authenticate之后。每个响应都带有RateLimit-*响应头，被拒绝时带有Retry-After。
+// 限流状态由app.limiter保存：单实例部署使用进程内的令牌桶，
+// 部署多个实例时使用Redis滑动窗口，所有实例共同计数（limiter.backend=redis）。
+func (app *application) rateLimit(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 动态获取ratelimit配置（可以热加载），如果启用了速率限制，则执行以下操作。
+		limiterConfig := app.liveConfig().limiter
+		group, ok := rateLimitGroups[r.Method+" "+routePattern(router, r)]
+		if !ok {
+			group = rateLimitGroupDefault
+		}
+		if limiterConfig.enabled && group != rateLimitGroupExempt {
+			// 取出客户端的IP地址（经过可信代理时使用代理转发的地址）
+			ip := app.clientIP(r)
+			policy := rateLimitPolicyFor(limiterConfig.policies, limiterConfig.rps, limiterConfig.burst, group)
+			if !app.allowRequest(w, r, group+":"+app.rateLimitIdentity(r, policy.key, ip), policy.limit) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 创建中间件limitCredentials，在authenticate之前按IP限制携带Authorization请求头的请求，
+// 避免无效的令牌和API密钥在返回401之前绕过rateLimit：猜测凭证同样受到限流，
+// 每次猜测触发的数据库查询也受到限制，并且401响应同样带有RateLimit-*响应头
+func (app *application) limitCredentials(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiterConfig := app.liveConfig().limiter
+		if r.Header.Get("Authorization") != "" && limiterConfig.enabled &&
+			rateLimitGroups[r.Method+" "+routePattern(router, r)] != rateLimitGroupExempt {
+			policy := rateLimitPolicyFor(limiterConfig.policies, limiterConfig.rps, limiterConfig.burst, rateLimitGroupCredentials)
+			if !app.allowRequest(w, r, rateLimitGroupCredentials+":ip:"+app.clientIP(r), policy.limit) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRequest 按key计数并设置RateLimit-*响应头，超过配额时返回429并返回false
+func (app *application) allowRequest(w http.ResponseWriter, r *http.Request, key string, limit ratelimit.Limit) bool {
+	result, err := app.limiter.Allow(r.Context(), key, limit)
+	if err != nil {
+		// 限流存储不可用时放行请求，避免Redis故障导致整个API不可用
+		app.logger.PrintError(err, map[string]string{
+			"action": "rate limiter unavailable, allowing request",
+		})
+		return true
 	}
-	// 声明对应的互斥锁和client
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
 
-	// 创建一个goroutine，用于清理过期的IP地址。
-	go func() {
-		for {
-			time.Sleep(time.Minute)
+	setRateLimitHeaders(w, result)
+	if !result.Allowed {
+		app.metrics.rateLimited.Inc()
+		app.rateLimitExceededResponse(w, r, result.RetryAfter)
+		return false
+	}
+	return true
+}
 
-			// 上锁
-			mu.Lock()
+// 创建中间件authenticate，用于从Authorization请求头中识别当前用户
+// 没有提供令牌时，将用户设置为匿名用户；令牌无效时返回401
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 响应内容会根据Authorization请求头变化，需要告知缓存
+		w.Header().Add("Vary", "Authorization")
 
-			// 遍历clients，并删除超过3分钟没有使用的IP地址
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-			// 释放互斥锁
-			mu.Unlock()
+		authorizationHeader := r.Header.Get("Authorization")
+		// 没有Authorization请求头，则为匿名用户
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
 		}
-	}()
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// 动态获取ratelimit配置，如果启用了速率限制，则执行以下操作。
-		if app.config.limiter.enabled {
-			// 取出请求的IP地址
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		// 请求头的格式必须为 "Bearer <token>" 或 "ApiKey <key>"
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		switch headerParts[0] {
+		case "Bearer":
+			app.authenticateBearer(w, r, headerParts[1], next)
+		case "ApiKey":
+			app.authenticateAPIKey(w, r, headerParts[1], next)
+		default:
+			app.invalidAuthenticationTokenResponse(w, r)
+		}
+	})
+}
+
+// authenticateBearer 校验Bearer令牌（数据库令牌或JWT），成功后调用下一个处理器
+func (app *application) authenticateBearer(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	// JWT模式下只校验签名和声明，不访问数据库
+	if app.config.auth.mode == authModeJWT {
+		user, permissions, err := app.parseJWT(token)
+		if err != nil {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		r = app.contextSetUser(r, user)
+		r = app.contextSetPermissions(r, permissions)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	// 校验令牌格式
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	// 查询令牌对应的用户
+	user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopeAuthentication, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	next.ServeHTTP(w, r)
+}
+
+// authenticateAPIKey 校验API密钥，请求的权限限定为密钥自身的权限子集
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	// 校验密钥格式
+	v := validator.New()
+	if data.ValidateAPIKeyPlaintext(v, key); !v.Valid() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	// 查询密钥对应的用户和权限
+	user, permissions, err := app.models.WithContext(r.Context()).APIKeys.GetForKey(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 用户自身被收回的权限，即使密钥中仍然存在也不再生效
+	granted, err := app.models.WithContext(r.Context()).Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetPermissions(r, permissions.Intersect(granted))
+	r = app.contextSetCredential(r, apiKeyCredential(key))
+	next.ServeHTTP(w, r)
+}
+
+// 创建中间件requireAuthenticatedUser，要求用户已登录
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// 创建中间件requireActivatedUser，要求用户已登录并且已激活
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	// 先检查是否登录，再检查是否激活
+	return app.requireAuthenticatedUser(fn)
+}
+
+// 创建中间件requireUserCredential，拒绝使用API密钥的请求。
+// API密钥只用于访问数据，不能创建、吊销密钥或修改两步验证，否则一个权限受限的密钥可以为自己签发权限更大的密钥
+func (app *application) requireUserCredential(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(app.contextGetCredential(r), apiKeyCredentialPrefix) {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// 创建中间件requirePermission，要求用户拥有指定的权限
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		// 凭证自带权限时（例如JWT）直接使用，否则从数据库中查询
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+			permissions, err = app.models.WithContext(r.Context()).Permissions.GetAllForUser(user.ID)
 			if err != nil {
 				app.serverErrorResponse(w, r, err)
 				return
 			}
-			mu.Lock()
-			// 如果该IP地址不在map中，则创建一个新的rate.Limiter对象，并将其添加到map中。
-			if _, found := clients[ip]; !found {
-				//clients[ip] = &client{limiter: rate.NewLimiter(2, 4)}
-				clients[ip] = &client{
-					// 设置其速率为2个请求/秒，并且最多允许4个请求。
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
-				}
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return app.requireActivatedUser(fn)
+}
+
+// CORS预检请求允许的方法和请求头
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, If-Match"
+)
+
+// enableCORS 创建中间件enableCORS，只对 -cors-trusted-origins 中的源返回跨域响应头。
+// 可信源支持三种写法：完整的源（https://www.example.com）、子域名通配（https://*.example.com）
+// 和 "*"（任意源，此时不允许携带凭证）。
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 响应内容会随Origin请求头变化，告诉缓存不要混用
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		corsConfig := app.liveConfig().cors
+		match := matchCORSOrigin(corsConfig.trustedOrigins, origin)
+		switch {
+		case match == "":
+			// 不可信的源不返回任何CORS响应头，由浏览器拒绝
+			next.ServeHTTP(w, r)
+			return
+		case match == "*":
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		default:
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if corsConfig.allowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
-			// 更新最后使用时间
-			clients[ip].lastSeen = time.Now()
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				app.rateLimitExceededResponse(w, r)
-				return
+		}
+
+		// 预检请求：OPTIONS方法并且带有Access-Control-Request-Method请求头
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			if maxAge := corsConfig.maxAge; maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
 			}
-			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+			return
 		}
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+// matchCORSOrigin 返回与origin匹配的可信源："*"表示通配所有源，空字符串表示不可信
+func matchCORSOrigin(trustedOrigins []string, origin string) string {
+	for _, trusted := range trustedOrigins {
+		switch {
+		case trusted == "*":
+			return "*"
+		case strings.EqualFold(trusted, origin):
+			return origin
+		case strings.Contains(trusted, "://*."):
+			// https://*.example.com 匹配 https://app.example.com，但不匹配 https://example.com
+			scheme, domain, _ := strings.Cut(trusted, "://*")
+			rest, ok := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if ok && len(rest) > len(domain) && strings.HasSuffix(rest, strings.ToLower(domain)) {
+				return origin
+			}
+		}
+	}
+	return ""
+}
+
+// 客户端传入的X-Request-ID最大长度，超出或包含非法字符时重新生成
+const maxRequestIDLength = 128
+
+// logRequest 创建中间件logRequest，为每个请求分配或沿用X-Request-ID，并在请求结束后输出一行JSON访问日志
+func (app *application) logRequest(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			var err error
+			id, err = newRequestID()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		info := &requestInfo{id: id}
+		r = app.contextSetRequestInfo(r, info)
+
+		mw := newMetricsResponseWriter(w)
+		next.ServeHTTP(mw, r)
+
+		ip := app.clientIP(r)
+
+		properties := map[string]string{
+			"request_id":  id,
+			"method":      r.Method,
+			"route":       routePattern(router, r),
+			"path":        r.URL.Path,
+			"status":      strconv.Itoa(mw.statusCode),
+			"bytes":       strconv.Itoa(mw.bytes),
+			"duration_ms": strconv.FormatFloat(float64(time.Since(start).Microseconds())/1000, 'f', 3, 64),
+			"remote_ip":   ip,
+		}
+		if info.userID != 0 {
+			properties["user_id"] = strconv.FormatInt(info.userID, 10)
+		}
+		if info.traceID != "" {
+			properties["trace_id"] = info.traceID
+		}
+
+		app.logger.PrintInfo("request", properties)
+	})
+}
+
+// traceRequest 创建中间件traceRequest，为每个请求创建一个服务端span。
+// 请求带有合法的traceparent时沿用上游的追踪ID和采样决定，数据库查询和邮件发送的span都挂在该span之下。
+func (app *application) traceRequest(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := trace.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = trace.ContextWithRemoteParent(ctx, parent)
+		}
+
+		// 路由模式在请求开始时就能确定，span名称使用路由模式而不是实际路径
+		route := routePattern(router, r)
+		name := r.Method + " " + route
+		if route == "" {
+			name = r.Method
+		}
+
+		ctx, span := app.tracer.Start(ctx, name, trace.SpanKindServer)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+
+		info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo)
+		if ok {
+			info.traceID = span.SpanContext().TraceID.String()
+			span.SetAttribute("http.request_id", info.id)
+		}
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		if route != "" {
+			span.SetAttribute("http.route", route)
+		}
+
+		mw := newMetricsResponseWriter(w)
+		next.ServeHTTP(mw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", mw.statusCode)
+		if ok && info.userID != 0 {
+			span.SetAttribute("enduser.id", info.userID)
+		}
+		if mw.statusCode >= 500 {
+			span.RecordError(fmt.Errorf("server responded with status %d", mw.statusCode))
+		}
+	})
+}
+
+// validRequestID 只接受由字母、数字和 -_.: 组成的请求ID，避免日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID 生成一个随机的请求ID（16字节，十六进制编码）
+func newRequestID() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/jsonlog"
+	"DesignMode/GreenLight/internal/jwt"
+	"DesignMode/GreenLight/internal/ratelimit"
+	"DesignMode/GreenLight/internal/redis/redistest"
+	"DesignMode/GreenLight/internal/trace"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestApplication 创建一个用于测试的application，不连接数据库
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	var cfg config
+	cfg.env = "development"
+
+	limiter := ratelimit.NewMemory()
+	t.Cleanup(func() { limiter.Close() })
+
+	return &application{
+		config:  cfg,
+		logger:  jsonlog.NewLogger(io.Discard, jsonlog.LevelInfo),
+		limiter: limiter,
+		metrics: newAppMetrics(nil),
+	}
+}
+
+// TestAuthenticateJWT 测试JWT模式下认证中间件只依赖签名校验，不访问数据库
+func TestAuthenticateJWT(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.auth.mode = authModeJWT
+	app.config.auth.jwt.issuer = "greenlight"
+	app.config.auth.jwt.audience = "greenlight-api"
+	app.config.auth.jwt.ttl = time.Hour
+
+	key, err := jwt.NewHMACKey("k1", bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.jwtKeys = jwt.NewKeySet(key)
+
+	token, err := app.newJWT(&data.User{ID: 7, Activated: true}, data.Permissions{"movies:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// app.models 没有数据库连接，一旦访问数据库就会panic
+	next := app.requirePermission("movies:read", func(w http.ResponseWriter, r *http.Request) {
+		if id := app.contextGetUser(r).ID; id != 7 {
+			t.Errorf("want user id 7; got %d", id)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := app.authenticate(next)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"valid token", "Bearer " + token.Plaintext, http.StatusOK},
+		{"tampered token", "Bearer " + token.Plaintext + "x", http.StatusUnauthorized},
+		{"wrong scheme", "Basic " + token.Plaintext, http.StatusUnauthorized},
+		{"anonymous", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want status %d; got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// TestEnableCORS 测试可信源、不可信源和通配源的跨域响应头以及预检请求
+func TestEnableCORS(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.cors.trustedOrigins = []string{"https://www.example.com", "https://*.example.org"}
+	app.config.cors.allowCredentials = true
+	app.config.cors.maxAge = 10 * time.Minute
+
+	handler := app.enableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name            string
+		trusted         []string
+		method          string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantAllowOrigin string
+		wantCredentials bool
+	}{
+		{"no origin", nil, http.MethodGet, "", false, http.StatusTeapot, "", false},
+		{"trusted", nil, http.MethodGet, "https://www.example.com", false, http.StatusTeapot, "https://www.example.com", true},
+		{"untrusted", nil, http.MethodGet, "https://evil.com", false, http.StatusTeapot, "", false},
+		{"subdomain wildcard", nil, http.MethodGet, "https://app.example.org", false, http.StatusTeapot, "https://app.example.org", true},
+		{"subdomain wildcard excludes apex", nil, http.MethodGet, "https://example.org", false, http.StatusTeapot, "", false},
+		{"subdomain wildcard checks scheme", nil, http.MethodGet, "http://app.example.org", false, http.StatusTeapot, "", false},
+		{"wildcard", []string{"*"}, http.MethodGet, "https://evil.com", false, http.StatusTeapot, "*", false},
+		{"trusted preflight", nil, http.MethodOptions, "https://www.example.com", true, http.StatusOK, "https://www.example.com", true},
+		{"untrusted preflight", nil, http.MethodOptions, "https://evil.com", true, http.StatusTeapot, "", false},
+		{"options without preflight", nil, http.MethodOptions, "https://www.example.com", false, http.StatusTeapot, "https://www.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.trusted != nil {
+				saved := app.config.cors.trustedOrigins
+				app.config.cors.trustedOrigins = tt.trusted
+				defer func() { app.config.cors.trustedOrigins = saved }()
+			}
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, "/v1/movies", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+				r.Header.Set("Access-Control-Request-Headers", "Authorization, If-Match")
+			}
+
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want status %d; got %d", tt.wantStatus, rr.Code)
+			}
+			if got := rr.Header().Values("Vary"); len(got) == 0 || got[0] != "Origin" {
+				t.Errorf("want Vary: Origin; got %q", got)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("want Access-Control-Allow-Origin %q; got %q", tt.wantAllowOrigin, got)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+				t.Errorf("want credentials %t; got %t", tt.wantCredentials, got)
+			}
+
+			if tt.preflight && tt.wantAllowOrigin != "" {
+				if got := rr.Header().Get("Access-Control-Allow-Headers"); got != corsAllowedHeaders {
+					t.Errorf("want Access-Control-Allow-Headers %q; got %q", corsAllowedHeaders, got)
+				}
+				if got := rr.Header().Get("Access-Control-Allow-Methods"); got != corsAllowedMethods {
+					t.Errorf("want Access-Control-Allow-Methods %q; got %q", corsAllowedMethods, got)
+				}
+				if got := rr.Header().Get("Access-Control-Max-Age"); got != "600" {
+					t.Errorf("want Access-Control-Max-Age 600; got %q", got)
+				}
+			}
+		})
+	}
+}
+
+// TestLogRequest 测试请求ID的生成与沿用、错误响应中的请求ID，以及访问日志的内容
+func TestLogRequest(t *testing.T) {
+	var logs bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = jsonlog.NewLogger(&logs, jsonlog.LevelInfo)
+	app.config.auth.mode = authModeJWT
+	app.config.auth.jwt.ttl = time.Hour
+
+	key, err := jwt.NewHMACKey("k1", bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.jwtKeys = jwt.NewKeySet(key)
+	token, err := app.newJWT(&data.User{ID: 7, Activated: true}, data.Permissions{"metrics:view"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := app.routes()
+
+	tests := []struct {
+		name          string
+		path          string
+		requestID     string
+		authorization string
+		wantStatus    int
+		wantRoute     string
+		wantUserID    string
+	}{
+		{"propagated id", "/v1/does-not-exist", "abc-123", "", http.StatusNotFound, "", ""},
+		{"invalid id", "/v1/does-not-exist", "bad id\n", "", http.StatusNotFound, "", ""},
+		{"authenticated user", "/metrics", "", "Bearer " + token.Plaintext, http.StatusOK, "/metrics", "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.requestID != "" {
+				r.Header.Set("X-Request-ID", tt.requestID)
+			}
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			handler.ServeHTTP(rr, r)
+			bodyLen := rr.Body.Len()
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("want status %d; got %d", tt.wantStatus, rr.Code)
+			}
+
+			id := rr.Header().Get("X-Request-ID")
+			switch {
+			case tt.requestID != "" && validRequestID(tt.requestID):
+				if id != tt.requestID {
+					t.Errorf("want request id %q; got %q", tt.requestID, id)
+				}
+			case len(id) != 32:
+				t.Errorf("want generated request id; got %q", id)
+			}
+
+			if rr.Code >= 400 {
+				var body struct {
+					RequestID string `json:"request_id"`
+				}
+				if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				if body.RequestID != id {
+					t.Errorf("want request id %q in error response; got %q", id, body.RequestID)
+				}
+			}
+
+			var entry struct {
+				Message    string            `json:"message"`
+				Properties map[string]string `json:"properties"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("want exactly one JSON log line; got %q", logs.String())
+			}
+			p := entry.Properties
+			if entry.Message != "request" || p["request_id"] != id || p["method"] != http.MethodGet ||
+				p["route"] != tt.wantRoute || p["status"] != strconv.Itoa(tt.wantStatus) ||
+				p["user_id"] != tt.wantUserID || p["remote_ip"] != "192.0.2.1" || p["bytes"] != strconv.Itoa(bodyLen) {
+				t.Errorf("unexpected access log entry %v", p)
+			}
+		})
+	}
+}
+
+// TestTraceRequest 测试请求span沿用上游的traceparent，并在访问日志中输出追踪ID
+func TestTraceRequest(t *testing.T) {
+	var logs, spans bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = jsonlog.NewLogger(&logs, jsonlog.LevelInfo)
+	app.tracer = trace.NewTracer("test", trace.NewWriterExporter(&spans), 1, nil)
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	// 无效的ID在访问数据库之前返回404，只产生请求的span
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies/abc", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	app.routes().ServeHTTP(rr, r)
+
+	if err := app.tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var span struct {
+		Name         string                 `json:"name"`
+		Kind         string                 `json:"kind"`
+		TraceID      string                 `json:"trace_id"`
+		ParentSpanID string                 `json:"parent_span_id"`
+		Attributes   map[string]interface{} `json:"attributes"`
+	}
+	if err := json.Unmarshal(spans.Bytes(), &span); err != nil {
+		t.Fatalf("want exactly one span; got %q", spans.String())
+	}
+	if span.Name != "GET /v1/movies/:id" || span.Kind != "server" || span.TraceID != traceID || span.ParentSpanID != parentSpanID {
+		t.Errorf("unexpected span %+v", span)
+	}
+	if span.Attributes["http.route"] != "/v1/movies/:id" || span.Attributes["http.status_code"] != float64(rr.Code) ||
+		span.Attributes["http.request_id"] != rr.Header().Get("X-Request-ID") {
+		t.Errorf("unexpected span attributes %v", span.Attributes)
+	}
+
+	var entry struct {
+		Properties map[string]string `json:"properties"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("want exactly one JSON log line; got %q", logs.String())
+	}
+	if entry.Properties["trace_id"] != traceID {
+		t.Errorf("want trace id %q in access log; got %v", traceID, entry.Properties)
+	}
+}
+
+// TestRateLimitRedisBackend 测试使用Redis后端时多个实例共同计数，Redis不可用时放行请求
+func TestRateLimitRedisBackend(t *testing.T) {
+	srv := redistest.NewServer(t)
+
+	var instances []http.Handler
+	for i := 0; i < 2; i++ {
+		app := newTestApplication(t)
+		app.config.limiter.enabled = true
+		app.config.limiter.rps = 1
+		app.config.limiter.burst = 3
+		app.config.limiter.backend = "redis"
+		app.config.limiter.redisURL = srv.URL()
+		app.config.limiter.redisPrefix = "greenlight:ratelimit:"
+		app.limiter = newLimiter(app.config)
+		t.Cleanup(func() { app.limiter.Close() })
+		instances = append(instances, app.authenticate(app.rateLimit(newPatternRouter(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+	}
+
+	request := func(h http.Handler) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr.Code
+	}
+
+	var codes []int
+	for i := 0; i < 4; i++ {
+		codes = append(codes, request(instances[i%2]))
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusOK || codes[3] != http.StatusTooManyRequests {
+		t.Errorf("want the fourth request across instances to be limited; got %v", codes)
+	}
+
+	srv.Close()
+	if code := request(instances[0]); code != http.StatusOK {
+		t.Errorf("want requests allowed while redis is unavailable; got %d", code)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/mailer"
+	"DesignMode/GreenLight/internal/oidc"
+	"DesignMode/GreenLight/internal/trace"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TODO 该文件存储OpenID Connect社交登录（授权码 + PKCE）相关的处理函数
+
+// 登录开始到回调之间允许的最长时间
+const oauthStateTTL = 10 * time.Minute
+
+// errOAuthEmailNotVerified 身份提供方没有验证该邮箱，不能用来创建、关联或激活本地账户
+var errOAuthEmailNotVerified = errors.New("oauth: email is not verified by the identity provider")
+
+// errOAuthAccountInactive 关联的账户已被管理员停用
+var errOAuthAccountInactive = errors.New("oauth: account has been deactivated")
+
+// parseOAuthProvider 解析 -oauth-provider 参数，格式为逗号分隔的key=value，例如
+// name=company,issuer=https://idp.example.com,client-id=greenlight,client-secret=xxx,redirect-url=https://api.example.com/v1/oauth/company/callback,scopes=openid email
+func parseOAuthProvider(val string) (oidc.Config, error) {
+	var cfg oidc.Config
+
+	for _, field := range strings.Split(val, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return cfg, fmt.Errorf("invalid oauth provider field %q", field)
+		}
+
+		switch key {
+		case "name":
+			cfg.Name = value
+		case "issuer":
+			cfg.Issuer = value
+		case "client-id":
+			cfg.ClientID = value
+		case "client-secret":
+			cfg.ClientSecret = value
+		case "redirect-url":
+			cfg.RedirectURL = value
+		case "scopes":
+			cfg.Scopes = strings.Fields(value)
+		default:
+			return cfg, fmt.Errorf("unknown oauth provider field %q", key)
+		}
+	}
+
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, errors.New("oauth provider requires name, issuer, client-id and redirect-url")
+	}
+
+	return cfg, nil
+}
+
+// newOAuthProviders 根据配置创建身份提供方，发现文档在第一次登录时获取。
+// 对身份提供方的请求会创建客户端span并传播traceparent。
+func newOAuthProviders(configs []oidc.Config) (map[string]*oidc.Provider, error) {
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &trace.Transport{},
+	}
+
+	providers := make(map[string]*oidc.Provider, len(configs))
+	for _, cfg := range configs {
+		if _, exists := providers[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate oauth provider %q", cfg.Name)
+		}
+		providers[cfg.Name] = oidc.NewProvider(cfg, client)
+	}
+	return providers, nil
+}
+
+// oauthState 登录开始时生成、回调时校验的数据
+type oauthState struct {
+	provider string
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// oauthStateStore 保存进行中的登录，每个state只能使用一次。
+// 与loginGuard一样只保存在进程内存中，多实例部署时需要会话保持。
+type oauthStateStore struct {
+	mu     sync.Mutex
+	states map[string]oauthState
+	now    func() time.Time
+}
+
+// newOAuthStateStore 创建state存储，并启动一个goroutine清理过期的记录
+func newOAuthStateStore() *oauthStateStore {
+	s := &oauthStateStore{
+		states: make(map[string]oauthState),
+		now:    time.Now,
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			s.cleanup()
+		}
+	}()
+
+	return s
+}
+
+// put 保存一个state
+func (s *oauthStateStore) put(state string, st oauthState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st.expires = s.now().Add(oauthStateTTL)
+	s.states[state] = st
+}
+
+// take 取出并删除一个state，不存在或已过期时返回false
+func (s *oauthStateStore) take(state string) (oauthState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.states[state]
+	delete(s.states, state)
+	if !ok || !s.now().Before(st.expires) {
+		return oauthState{}, false
+	}
+	return st, true
+}
+
+// cleanup 删除过期的state
+func (s *oauthStateStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for state, st := range s.states {
+		if !now.Before(st.expires) {
+			delete(s.states, state)
+		}
+	}
+}
+
+// 开始社交登录 startOAuthHandler
+// 生成state、nonce和PKCE校验码，并重定向到身份提供方的授权端点
+func (app *application) startOAuthHandler(w http.ResponseWriter, r *http.Request) {
+	name := app.readStringParam(r, "provider")
+	provider, ok := app.oauthProviders[name]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.oauthStates.put(state, oauthState{provider: name, nonce: nonce, verifier: verifier})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// 社交登录回调 oauthCallbackHandler
+// 兑换授权码、校验ID令牌，关联或创建本地用户，并签发认证令牌
+func (app *application) oauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := app.readStringParam(r, "provider")
+	provider, ok := app.oauthProviders[name]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	// 用户拒绝授权或身份提供方返回错误
+	if idpErr := qs.Get("error"); idpErr != "" {
+		app.oauthFailedResponse(w, r, fmt.Errorf("identity provider returned %s: %s", idpErr, qs.Get("error_description")))
+		return
+	}
+
+	// state只能使用一次，并且必须属于同一个身份提供方
+	st, ok := app.oauthStates.take(qs.Get("state"))
+	if !ok || st.provider != name {
+		app.oauthFailedResponse(w, r, errors.New("invalid or expired oauth state"))
+		return
+	}
+
+	tokens, err := provider.Exchange(r.Context(), qs.Get("code"), st.verifier)
+	if err != nil {
+		app.oauthFailedResponse(w, r, err)
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(r.Context(), tokens.IDToken, st.nonce)
+	if err != nil {
+		app.oauthFailedResponse(w, r, err)
+		return
+	}
+
+	user, err := app.linkOAuthUser(r, name, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOAuthEmailNotVerified):
+			v := map[string]string{"email": "must be verified by the identity provider"}
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, errOAuthAccountInactive):
+			app.inactiveAccountResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 启用了两步验证的账户仍然需要完成第二步
+	if app.requireSecondFactor(w, r, user) {
+		return
+	}
+
+	token, err := app.issueAuthenticationToken(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// linkOAuthUser 查找外部身份关联的用户。未关联时，按邮箱关联到已有用户，或者创建一个新用户（使用随机密码）。
+// 身份提供方必须验证过邮箱，未验证的邮箱不能关联已有账户，也不能创建账户占用该邮箱，返回errOAuthEmailNotVerified。
+// 等待激活的账户在身份提供方验证了账户的邮箱后被激活；
+// 被管理员停用的账户返回errOAuthAccountInactive，社交登录不能重新启用
+func (app *application) linkOAuthUser(r *http.Request, provider string, claims *oidc.Claims) (*data.User, error) {
+	user, err := app.models.WithContext(r.Context()).Identities.GetUser(provider, claims.Subject)
+	if err == nil {
+		if !user.Activated {
+			// 身份提供方验证的必须是账户自己的邮箱
+			if !claims.EmailVerified || !strings.EqualFold(claims.Email, user.Email) {
+				if !user.PendingActivation() {
+					return nil, errOAuthAccountInactive
+				}
+				return nil, errOAuthEmailNotVerified
+			}
+			err = app.activateOAuthUser(r, user)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("oauth: id token has no email claim")
+	}
+
+	user, err = app.models.WithContext(r.Context()).Users.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// 未经验证的邮箱不能用来接管已有账户
+		if !claims.EmailVerified {
+			return nil, errOAuthEmailNotVerified
+		}
+		if !user.Activated {
+			err = app.activateOAuthUser(r, user)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, data.ErrRecordNotFound):
+		// 未经验证的邮箱不能创建账户，否则邮箱的真正所有者无法再注册
+		if !claims.EmailVerified {
+			return nil, errOAuthEmailNotVerified
+		}
+		user = &data.User{
+			Name:      claims.Name,
+			Email:     claims.Email,
+			Activated: true,
+			Language:  mailer.MatchLanguage(r.Header.Get("Accept-Language")),
+		}
+		if user.Name == "" {
+			user.Name, _, _ = strings.Cut(claims.Email, "@")
+		}
+		// 通过社交登录创建的用户没有可用的密码，需要时可以通过重置密码设置
+		err = user.Password.SetRandom()
+		if err != nil {
+			return nil, err
+		}
+		err = app.models.WithContext(r.Context()).Users.Insert(user)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = app.models.WithContext(r.Context()).Identities.Insert(&data.Identity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	app.logger.PrintInfo("linked external identity", map[string]string{
+		"user_id":  strconv.FormatInt(user.ID, 10),
+		"provider": provider,
+	})
+
+	return user, nil
+}
+
+// activateOAuthUser 激活身份提供方验证了邮箱的账户，被管理员停用的账户返回errOAuthAccountInactive
+func (app *application) activateOAuthUser(r *http.Request, user *data.User) error {
+	if !user.PendingActivation() {
+		return errOAuthAccountInactive
+	}
+
+	user.Activated = true
+	return app.models.WithContext(r.Context()).Users.Update(user)
+}
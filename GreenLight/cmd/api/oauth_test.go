@@ -0,0 +1,217 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/jwt"
+	"DesignMode/GreenLight/internal/oidc"
+	"DesignMode/GreenLight/internal/oidc/oidctest"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newOAuthTestApplication 创建一个连接到模拟身份提供方的application
+func newOAuthTestApplication(t *testing.T) (*application, *oidctest.Server) {
+	t.Helper()
+
+	idp := oidctest.NewServer(t, "greenlight", "secret")
+	app := newTestApplication(t)
+	app.oauthStates = &oauthStateStore{states: make(map[string]oauthState), now: time.Now}
+	app.oauthProviders = map[string]*oidc.Provider{
+		"company": oidc.NewProvider(oidc.Config{
+			Name:         "company",
+			Issuer:       idp.Issuer(),
+			ClientID:     "greenlight",
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost:4000/v1/oauth/company/callback",
+		}, idp.Client()),
+	}
+
+	return app, idp
+}
+
+// TestOAuthStart 测试开始登录时重定向到身份提供方，并携带PKCE质询码
+func TestOAuthStart(t *testing.T) {
+	app, idp := newOAuthTestApplication(t)
+	handler := app.routes()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/oauth/company/start", nil))
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("want status %d; got %d", http.StatusFound, rr.Code)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := location.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		t.Errorf("unexpected authorization request %s", location)
+	}
+
+	// 身份提供方接受这个请求，并把state原样带回
+	callback, err := idp.Authorize(location.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, ok := app.oauthStates.take(callback.Query().Get("state"))
+	if !ok || st.provider != "company" || oidc.Challenge(st.verifier) != q.Get("code_challenge") {
+		t.Errorf("state does not match the authorization request: %+v", st)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/oauth/unknown/start", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d for unknown provider; got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+// TestOAuthCallbackRejects 测试回调在访问数据库之前拒绝无效的请求
+func TestOAuthCallbackRejects(t *testing.T) {
+	app, idp := newOAuthTestApplication(t)
+	handler := app.routes()
+
+	// 在身份提供方完成授权，得到有效的code和state
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/oauth/company/start", nil))
+	callback, err := idp.Authorize(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := callback.Query().Get("code"), callback.Query().Get("state")
+
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"denied", url.Values{"error": {"access_denied"}, "state": {state}}},
+		{"unknown state", url.Values{"code": {code}, "state": {"forged"}}},
+		{"missing state", url.Values{"code": {code}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/oauth/company/callback?"+tt.query.Encode(), nil)
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("want status %d; got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
+
+// TestOAuthStateExpiry 测试state过期后和使用过一次后都不能再使用
+func TestOAuthStateExpiry(t *testing.T) {
+	now := time.Now()
+	s := &oauthStateStore{states: make(map[string]oauthState), now: func() time.Time { return now }}
+
+	s.put("a", oauthState{provider: "company"})
+	s.put("b", oauthState{provider: "company"})
+
+	if _, ok := s.take("a"); !ok {
+		t.Error("want state a to be valid")
+	}
+	if _, ok := s.take("a"); ok {
+		t.Error("want state a to be single use")
+	}
+
+	now = now.Add(oauthStateTTL)
+	if _, ok := s.take("b"); ok {
+		t.Error("want state b to be expired")
+	}
+}
+
+// TestParseOAuthProvider 测试 -oauth-provider 参数的解析
+func TestParseOAuthProvider(t *testing.T) {
+	cfg, err := parseOAuthProvider("name=company,issuer=https://idp.example.com,client-id=gl,redirect-url=https://api.example.com/cb,scopes=openid email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "company" || cfg.ClientID != "gl" || len(cfg.Scopes) != 2 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	for _, val := range []string{"name=company", "name=company,issuer", "name=c,issuer=i,client-id=c,redirect-url=r,colour=blue"} {
+		if _, err := parseOAuthProvider(val); err == nil {
+			t.Errorf("want error for %q", val)
+		}
+	}
+}
+
+// TestLinkOAuthUser 测试社交登录只使用身份提供方验证过的邮箱：未验证的邮箱不能创建账户，
+// 等待激活的账户在邮箱验证后被激活，被管理员停用的账户不能重新启用
+func TestLinkOAuthUser(t *testing.T) {
+	deactivatedAt := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name          string
+		linked        bool
+		deactivatedAt interface{}
+		email         string
+		verified      bool
+		wantErr       error
+		wantActivated bool
+		wantInsert    bool
+	}{
+		{"linked pending user verified", true, nil, "alice@example.com", true, nil, true, false},
+		{"linked pending user unverified", true, nil, "alice@example.com", false, errOAuthEmailNotVerified, false, false},
+		{"linked pending user verified another email", true, nil, "mallory@example.com", true, errOAuthEmailNotVerified, false, false},
+		{"linked deactivated user", true, deactivatedAt, "alice@example.com", true, errOAuthAccountInactive, false, false},
+		{"new verified email", false, nil, "alice@example.com", true, nil, true, true},
+		{"new unverified email", false, nil, "alice@example.com", false, errOAuthEmailNotVerified, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			identity := [][]driver.Value{}
+			if tt.linked {
+				identity = append(identity, []driver.Value{
+					int64(5), time.Now(), "Alice", "alice@example.com", []byte("hash"), false, tt.deactivatedAt, "en", int64(1),
+				})
+			}
+			db := &execDB{rows: map[string][][]driver.Value{
+				"WHERE user_identities.provider = ?": identity,
+				"WHERE email = ?":                    {},
+			}}
+			conn := sql.OpenDB(db)
+			t.Cleanup(func() { conn.Close() })
+			app.models = data.NewModels(conn)
+
+			claims := &oidc.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "sub-1"}, Email: tt.email, EmailVerified: tt.verified}
+			r := httptest.NewRequest(http.MethodGet, "/v1/oauth/company/callback", nil)
+			user, err := app.linkOAuthUser(r, "company", claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want error %v; got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				if len(db.execs) != 0 {
+					t.Errorf("want nothing written; got %v", db.execs)
+				}
+				return
+			}
+
+			if user.Activated != tt.wantActivated {
+				t.Errorf("want activated %v; got %v", tt.wantActivated, user.Activated)
+			}
+			if _, ok := db.find("INSERT INTO users"); ok != tt.wantInsert {
+				t.Errorf("want user inserted %v; got %v", tt.wantInsert, ok)
+			}
+			if tt.linked {
+				update, ok := db.find("UPDATE users")
+				if !ok || update.args[3] != true {
+					t.Errorf("want the pending user activated; got %v", db.execs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/trace"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TODO 该文件存储邮件发件箱：请求中将邮件写入数据库，后台worker领取到期的邮件并投递，
+// 失败时按指数退避重试，达到最大尝试次数后标记为dead，由管理员通过 /v1/admin/emails 查看和重试
+
+// queueMail 将发给用户的邮件写入发件箱，邮件使用用户的语言。
+// models可以是data.Models.Transaction中的事务，邮件与同一事务中的用户、令牌等一起提交，
+// 不会出现数据已写入而邮件丢失的情况。写入失败时返回错误，调用方应当让请求失败；
+// 提交后调用notifyMailQueued唤醒worker
+func (app *application) queueMail(models data.Models, user *data.User, templateFile string, mailData map[string]interface{}) error {
+	email := &data.Email{
+		Recipient: user.Email,
+		Template:  templateFile,
+		Language:  user.Language,
+		Data:      mailData,
+	}
+
+	return models.Emails.Insert(email)
+}
+
+// notifyMailQueued 在邮件提交后记录指标，并唤醒worker
+func (app *application) notifyMailQueued() {
+	app.metrics.mailQueued.Inc()
+	app.wakeMailWorkers()
+}
+
+// wakeMailWorkers 不等待下一次轮询，立即通知worker领取邮件（worker正忙时忽略）
+func (app *application) wakeMailWorkers() {
+	select {
+	case app.mailWake <- struct{}{}:
+	default:
+	}
+}
+
+// runMailWorkers 启动mail.workers个worker投递发件箱中的邮件。
+// 每次领取不超过worker数量的邮件，没有到期的邮件时等待mail.poll-interval或新邮件写入；
+// ctx结束时停止领取，等待已领取的邮件投递完成后返回。
+func (app *application) runMailWorkers(ctx context.Context) {
+	workers := app.config.mail.workers
+	jobs := make(chan *data.Email)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for email := range jobs {
+				app.deliverEmail(email)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(app.config.mail.pollInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		emails, err := app.models.Emails.Claim(workers, app.config.mail.lease)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"component": "mail outbox"})
+		}
+		for _, email := range emails {
+			jobs <- email
+		}
+
+		// 领取满一批时可能还有到期的邮件，直接继续领取
+		if err == nil && len(emails) == workers {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		case <-app.mailWake:
+		}
+	}
+}
+
+// deliverEmail 投递一封已领取的邮件：成功时标记为已投递，失败时按指数退避重新安排，
+// 达到mail.max-attempts时标记为dead，不再自动重试。
+// 投递不超过mail.send-timeout；超时时不知道邮件是否已经发出，保持领取状态，租约过期后重新投递，
+// 最后一次尝试超时时同样标记为dead，否则无响应的SMTP服务器会使邮件在每次租约过期后无限重试
+func (app *application) deliverEmail(email *data.Email) {
+	properties := map[string]string{
+		"email_id": strconv.FormatInt(email.ID, 10),
+		"template": email.Template,
+		"language": email.Language,
+		"attempts": strconv.Itoa(email.Attempts),
+	}
+
+	ctx := context.Background()
+	if app.config.mail.sendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, app.config.mail.sendTimeout)
+		defer cancel()
+	}
+
+	sendErr := app.sendMail(ctx, email.Recipient, email.Language, email.Template, email.Data)
+	if errors.Is(sendErr, context.DeadlineExceeded) && email.Attempts < app.config.mail.maxAttempts {
+		app.logger.PrintError(sendErr, properties)
+		return
+	}
+	if sendErr == nil {
+		err := app.models.Emails.MarkSent(email.ID)
+		if err != nil {
+			app.logger.PrintError(err, properties)
+		}
+		return
+	}
+
+	var err error
+	if email.Attempts >= app.config.mail.maxAttempts {
+		app.metrics.mailDead.Inc()
+		app.logger.PrintError(sendErr, properties)
+		err = app.models.Emails.MarkDead(email.ID, sendErr.Error())
+	} else {
+		next := time.Now().Add(mailBackoff(email.Attempts, app.config.mail.retryBackoff, app.config.mail.maxRetryBackoff))
+		properties["next_attempt_at"] = next.Format(time.RFC3339)
+		app.logger.PrintError(sendErr, properties)
+		err = app.models.Emails.Reschedule(email.ID, sendErr.Error(), next)
+	}
+	if err != nil {
+		app.logger.PrintError(err, properties)
+	}
+}
+
+// mailBackoff 返回第attempts次投递失败后的等待时间：base * 2^(attempts-1)，不超过max
+func mailBackoff(attempts int, base, max time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// sendMail 使用指定语言的模板渲染并发送邮件，统计发送结果。
+// ctx用于将发送邮件的span关联到上层的span，并限制等待发送的时间。
+func (app *application) sendMail(ctx context.Context, recipient, language, templateFile string, data interface{}) error {
+	_, span := trace.Start(ctx, "mailer.Send", trace.SpanKindClient)
+	span.SetAttribute("mail.template", templateFile)
+	span.SetAttribute("mail.language", language)
+	defer span.End()
+
+	// 发送方式不支持取消，超时后不再等待；SMTP每次读写都有超时，发送的goroutine最终会结束
+	done := make(chan error, 1)
+	go func() {
+		done <- app.mailer.SendLocalized(recipient, language, templateFile, data)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("sending email: %w", ctx.Err())
+	}
+	if err != nil {
+		span.RecordError(err)
+		app.metrics.mailFailed.Inc()
+		return err
+	}
+	app.metrics.mailSent.Inc()
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/mailer"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingTransport 总是发送失败的邮件发送方式
+type failingTransport struct{}
+
+func (failingTransport) Send(*mailer.Message) error { return errors.New("smtp: connection refused") }
+
+// blockingTransport 直到release关闭才返回的邮件发送方式，模拟响应缓慢的SMTP服务器
+type blockingTransport struct{ release chan struct{} }
+
+func (t blockingTransport) Send(*mailer.Message) error { <-t.release; return nil }
+
+// TestDeliverEmailTimeout 测试投递超过mail.send-timeout时不再等待，邮件保持领取状态，
+// 不会被立即重新安排（可能已经发出），由租约过期后重新投递；最后一次尝试超时时标记为dead
+func TestDeliverEmailTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		wantDead bool
+	}{
+		{"left to its lease", 2, false},
+		{"last attempt", 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := blockingTransport{release: make(chan struct{})}
+			defer close(transport.release)
+
+			app := newTestApplication(t)
+			app.mailer = newTestMailer(t, transport, "no-reply@greenlight.test")
+			app.config.mail.sendTimeout = 10 * time.Millisecond
+			app.config.mail.maxAttempts = 3
+
+			db := &execDB{}
+			conn := sql.OpenDB(db)
+			t.Cleanup(func() { conn.Close() })
+			app.models = data.NewModels(conn)
+
+			email := &data.Email{ID: 7, Recipient: "bob@example.com", Template: "account_locked.tmpl", Attempts: tt.attempts,
+				Data: map[string]interface{}{"ip": "203.0.113.7", "lockoutMinutes": 15}}
+
+			done := make(chan struct{})
+			go func() {
+				app.deliverEmail(email)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("want delivery bounded by mail.send-timeout")
+			}
+
+			if app.metrics.mailFailed.Value() != 1 {
+				t.Errorf("want the timeout counted as a failed attempt; got %d", app.metrics.mailFailed.Value())
+			}
+			if !tt.wantDead {
+				if len(db.execs) != 0 {
+					t.Errorf("want the email left to its lease; got %v", db.execs)
+				}
+				return
+			}
+
+			dead, ok := db.find("UPDATE emails")
+			if !ok || dead.args[0] != data.EmailDead || dead.args[2] != int64(7) {
+				t.Fatalf("want the email marked dead; got %v", db.execs)
+			}
+			if !strings.Contains(dead.args[1].(string), "deadline exceeded") {
+				t.Errorf("want the timeout recorded as the last error; got %v", dead.args[1])
+			}
+			if app.metrics.mailDead.Value() != 1 {
+				t.Errorf("want mail dead metric incremented; got %d", app.metrics.mailDead.Value())
+			}
+		})
+	}
+}
+
+// TestDeliverEmailRetries 测试投递失败后按指数退避重新安排，达到最大尝试次数后标记为dead
+func TestDeliverEmailRetries(t *testing.T) {
+	app := newTestApplication(t)
+	app.mailer = newTestMailer(t, failingTransport{}, "no-reply@greenlight.test")
+	app.config.mail.maxAttempts = 3
+	app.config.mail.retryBackoff = time.Minute
+	app.config.mail.maxRetryBackoff = time.Hour
+
+	db := &execDB{}
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() { conn.Close() })
+	app.models = data.NewModels(conn)
+
+	email := &data.Email{ID: 7, Recipient: "bob@example.com", Template: "account_locked.tmpl", Attempts: 2,
+		Data: map[string]interface{}{"ip": "203.0.113.7", "lockoutMinutes": 15}}
+
+	start := time.Now()
+	app.deliverEmail(email)
+	reschedule, ok := db.find("SET status = ?, next_attempt_at = ?, last_error = ?")
+	if !ok {
+		t.Fatal("want the email rescheduled")
+	}
+	next := reschedule.args[1].(time.Time)
+	if next.Before(start.Add(2*time.Minute)) || next.After(time.Now().Add(2*time.Minute)) {
+		t.Errorf("want second retry after 2m backoff; got %v", next.Sub(start))
+	}
+	if reschedule.args[0] != data.EmailPending || reschedule.args[2] != "smtp: connection refused" {
+		t.Errorf("unexpected reschedule args %v", reschedule.args)
+	}
+
+	email.Attempts = 3
+	app.deliverEmail(email)
+	dead, ok := db.find("SET status = ?, last_error = ?")
+	if !ok || dead.args[0] != data.EmailDead {
+		t.Fatalf("want the email dead-lettered after %d attempts", app.config.mail.maxAttempts)
+	}
+	if app.metrics.mailFailed.Value() != 2 || app.metrics.mailDead.Value() != 1 {
+		t.Errorf("want 2 failed attempts and 1 dead email; got %d and %d", app.metrics.mailFailed.Value(), app.metrics.mailDead.Value())
+	}
+}
+
+// TestMailBackoff 测试重试等待时间每次翻倍并且不超过上限
+func TestMailBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := mailBackoff(tt.attempts, 30*time.Second, time.Hour); got != tt.want {
+			t.Errorf("attempt %d: want %v; got %v", tt.attempts, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/ratelimit"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TODO 该文件存储限流策略：路由分组、每个分组的配额和计数方式（按用户、API密钥或IP），以及RateLimit-*响应头
+
+// 限流分组。没有列在rateLimitGroups中的路由属于默认分组，配额为limiter.rps和limiter.burst
+const (
+	rateLimitGroupDefault     = "default"
+	rateLimitGroupAuth        = "auth"        // 注册、激活、登录、修改密码等匿名可以访问且容易被滥用的接口
+	rateLimitGroupCredentials = "credentials" // 携带Authorization请求头的所有请求，在认证之前按IP计数，限制猜测令牌和API密钥
+	rateLimitGroupExempt      = "none"        // 不限流，用于负载均衡器频繁调用的健康检查
+)
+
+// rateLimitGroups 路由（方法 + 路由模式）所属的限流分组
+var rateLimitGroups = map[string]string{
+	"POST /v1/users":                 rateLimitGroupAuth,
+	"PUT /v1/users/activated":        rateLimitGroupAuth,
+	"PUT /v1/users/password":         rateLimitGroupAuth,
+	"POST /v1/tokens/authentication": rateLimitGroupAuth,
+	"POST /v1/tokens/2fa":            rateLimitGroupAuth,
+	"GET /v1/healthcheck/live":       rateLimitGroupExempt,
+	"GET /v1/healthcheck/ready":      rateLimitGroupExempt,
+}
+
+// 限流的计数方式
+const (
+	rateLimitKeyIP   = "ip"   // 按客户端IP计数
+	rateLimitKeyUser = "user" // 按API密钥或用户计数，匿名请求按IP计数
+)
+
+// rateLimitPolicy 一个分组的限流配额和计数方式
+type rateLimitPolicy struct {
+	limit ratelimit.Limit
+	key   string
+}
+
+// defaultRateLimitPolicies 返回各分组的默认策略，默认分组使用limiter.rps和limiter.burst
+func defaultRateLimitPolicies(rps float64, burst int) map[string]rateLimitPolicy {
+	return map[string]rateLimitPolicy{
+		rateLimitGroupDefault: {limit: ratelimit.Limit{Rate: rps, Burst: burst}, key: rateLimitKeyUser},
+		// 每个IP每5秒1次，最多连续5次
+		rateLimitGroupAuth: {limit: ratelimit.Limit{Rate: 0.2, Burst: 5}, key: rateLimitKeyIP},
+		// 同一IP下的所有凭证共用，配额高于默认分组，避免影响同一出口IP后的多个正常用户
+		rateLimitGroupCredentials: {limit: ratelimit.Limit{Rate: 10, Burst: 20}, key: rateLimitKeyIP},
+	}
+}
+
+// rateLimitPolicyFor 返回分组的限流策略，配置中没有时使用默认策略
+func rateLimitPolicyFor(policies map[string]rateLimitPolicy, rps float64, burst int, group string) rateLimitPolicy {
+	if policy, ok := policies[group]; ok {
+		return policy
+	}
+	return defaultRateLimitPolicies(rps, burst)[group]
+}
+
+// parseRateLimitPolicy 解析 group=auth,rps=0.2,burst=5[,key=ip|user] 格式的限流策略
+func parseRateLimitPolicy(val string) (string, rateLimitPolicy, error) {
+	var (
+		group  string
+		policy = rateLimitPolicy{key: rateLimitKeyUser}
+		err    error
+	)
+
+	for _, field := range strings.Split(val, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return "", policy, fmt.Errorf("invalid rate limit policy field %q", field)
+		}
+
+		switch key {
+		case "group":
+			group = value
+		case "rps":
+			policy.limit.Rate, err = strconv.ParseFloat(value, 64)
+		case "burst":
+			policy.limit.Burst, err = strconv.Atoi(value)
+		case "key":
+			policy.key = value
+		default:
+			return "", policy, fmt.Errorf("unknown rate limit policy field %q", key)
+		}
+		if err != nil {
+			return "", policy, fmt.Errorf("invalid rate limit policy %s %q", key, value)
+		}
+	}
+
+	if _, ok := defaultRateLimitPolicies(1, 1)[group]; !ok {
+		return "", policy, fmt.Errorf("unknown rate limit group %q (must be %s)", group, strings.Join(rateLimitGroupNames(), " or "))
+	}
+	if policy.limit.Rate <= 0 || policy.limit.Burst <= 0 {
+		return "", policy, errors.New("rate limit policy requires rps and burst greater than zero")
+	}
+	if policy.key != rateLimitKeyIP && policy.key != rateLimitKeyUser {
+		return "", policy, fmt.Errorf("rate limit policy key must be %s or %s", rateLimitKeyIP, rateLimitKeyUser)
+	}
+	// 认证之前还不知道用户，credentials分组只能按IP计数
+	if group == rateLimitGroupCredentials {
+		policy.key = rateLimitKeyIP
+	}
+	return group, policy, nil
+}
+
+// rateLimitGroupNames 返回所有分组的名称
+func rateLimitGroupNames() []string {
+	var names []string
+	for name := range defaultRateLimitPolicies(1, 1) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rateLimitIdentity 返回请求的计数对象：按用户计数时，API密钥请求按密钥计数，
+// 其余已认证的请求按用户计数，匿名请求按IP计数
+func (app *application) rateLimitIdentity(r *http.Request, key, ip string) string {
+	if key == rateLimitKeyUser {
+		if credential := app.contextGetCredential(r); credential != "" {
+			return credential
+		}
+		if user := app.contextGetUser(r); !user.IsAnonymous() {
+			return "user:" + strconv.FormatInt(user.ID, 10)
+		}
+	}
+	return "ip:" + ip
+}
+
+// apiKeyCredentialPrefix API密钥请求的凭证标识前缀
+const apiKeyCredentialPrefix = "apikey:"
+
+// apiKeyCredential 返回API密钥的计数标识，使用密钥的哈希而不是明文
+func apiKeyCredential(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return apiKeyCredentialPrefix + hex.EncodeToString(hash[:8])
+}
+
+// setRateLimitHeaders 设置RateLimit-Limit、RateLimit-Remaining和RateLimit-Reset（秒）响应头
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+// ceilSeconds 将时间向上取整为秒
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/jsonlog"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestRateLimitPolicies 测试不同路由分组使用各自的配额，按用户、API密钥或IP计数，并返回RateLimit-*响应头
+func TestRateLimitPolicies(t *testing.T) {
+	app := newTestApplication(t)
+	app.config = loadTestConfig(t, "-limiter-rps", "1", "-limiter-burst", "3", "-limiter-policy", "group=auth,rps=0.5,burst=2,key=ip")
+	if err := validateConfig(&app.config); err != nil {
+		t.Fatal(err)
+	}
+
+	router := newPatternRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandlerFunc(http.MethodPost, "/v1/users", ok)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", ok)
+	handler := app.rateLimit(router, router)
+
+	// request 以给定的用户（nil为匿名）和凭证从同一个IP发送请求
+	request := func(method, path string, user *data.User, credential string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if user == nil {
+			user = data.AnonymousUser
+		}
+		r = app.contextSetUser(r, user)
+		if credential != "" {
+			r = app.contextSetCredential(r, credential)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// 注册接口按IP计数，配额为2
+	for i := 0; i < 2; i++ {
+		rr := request(http.MethodPost, "/v1/users", nil, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("signup %d: want 200; got %d", i, rr.Code)
+		}
+		if rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != strconv.Itoa(1-i) {
+			t.Errorf("signup %d: unexpected headers %v", i, rr.Header())
+		}
+	}
+	rr := request(http.MethodPost, "/v1/users", &data.User{ID: 1}, "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("want third signup from the same IP limited; got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "2" || rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("unexpected 429 headers %v", rr.Header())
+	}
+
+	// 其他路由属于默认分组，不受注册接口配额影响；已认证用户按用户计数
+	for i := 0; i < 3; i++ {
+		if rr := request(http.MethodGet, "/v1/movies/1", &data.User{ID: 1}, ""); rr.Code != http.StatusOK {
+			t.Fatalf("user 1 request %d: want 200; got %d", i, rr.Code)
+		}
+	}
+	if rr := request(http.MethodGet, "/v1/movies/2", &data.User{ID: 1}, ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("want user 1 limited after 3 requests; got %d", rr.Code)
+	}
+	if rr := request(http.MethodGet, "/v1/movies/1", &data.User{ID: 2}, ""); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "3" {
+		t.Errorf("want user 2 counted separately; got %d %v", rr.Code, rr.Header())
+	}
+	if rr := request(http.MethodGet, "/v1/movies/1", &data.User{ID: 1}, apiKeyCredential("key")); rr.Code != http.StatusOK {
+		t.Errorf("want API key requests counted separately from the user; got %d", rr.Code)
+	}
+	if rr := request(http.MethodGet, "/v1/movies/1", nil, ""); rr.Code != http.StatusOK {
+		t.Errorf("want anonymous requests counted by IP; got %d", rr.Code)
+	}
+}
+
+// TestRateLimitInvalidCredentials 测试无效的API密钥在认证之前按IP限流：401响应带有RateLimit-*响应头，
+// 超过配额后返回429，并且不影响没有携带凭证的请求
+func TestRateLimitInvalidCredentials(t *testing.T) {
+	app := newTestApplication(t)
+	app.config = loadTestConfig(t, "-limiter-policy", "group=credentials,rps=0.5,burst=3")
+	if err := validateConfig(&app.config); err != nil {
+		t.Fatal(err)
+	}
+
+	router := newPatternRouter()
+	router.HandlerFunc(http.MethodGet, "/v1/movies", func(w http.ResponseWriter, r *http.Request) {})
+	handler := app.limitCredentials(router, app.authenticate(app.rateLimit(router, router)))
+
+	request := func(authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	for i := 0; i < 3; i++ {
+		rr := request("ApiKey guess")
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: want 401; got %d", i, rr.Code)
+		}
+		if rr.Header().Get("RateLimit-Limit") != "3" || rr.Header().Get("RateLimit-Remaining") != strconv.Itoa(2-i) {
+			t.Errorf("guess %d: want RateLimit headers on 401; got %v", i, rr.Header())
+		}
+	}
+	if rr := request("ApiKey guess"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("want guessing API keys limited; got %d", rr.Code)
+	}
+	if rr := request("Bearer guess"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("want bearer tokens counted against the same IP; got %d", rr.Code)
+	}
+	if rr := request(""); rr.Code != http.StatusOK {
+		t.Errorf("want anonymous requests unaffected; got %d", rr.Code)
+	}
+}
+
+// TestParseRateLimitPolicy 测试限流策略的解析和校验
+func TestParseRateLimitPolicy(t *testing.T) {
+	group, policy, err := parseRateLimitPolicy("group=default, rps=10, burst=20")
+	if err != nil || group != rateLimitGroupDefault || policy.limit.Rate != 10 || policy.limit.Burst != 20 || policy.key != rateLimitKeyUser {
+		t.Errorf("unexpected policy %q %+v %v", group, policy, err)
+	}
+
+	for _, spec := range []string{
+		"group=search,rps=1,burst=1",
+		"group=auth,rps=0,burst=1",
+		"group=auth,rps=1,burst=x",
+		"group=auth,rps=1,burst=1,key=email",
+		"group=auth,rps=1,burst=1,scope=all",
+	} {
+		if _, _, err := parseRateLimitPolicy(spec); err == nil {
+			t.Errorf("%s: want error", spec)
+		}
+	}
+}
+
+// TestClientIPBehindProxy 测试经过可信代理的请求按转发的客户端IP限流和记录访问日志，
+// 不可信的对端伪造的X-Forwarded-For不生效
+func TestClientIPBehindProxy(t *testing.T) {
+	var logs bytes.Buffer
+	app := newTestApplication(t)
+	app.config = loadTestConfig(t, "-limiter-rps", "1", "-limiter-burst", "1", "-trusted-proxies", "10.0.0.0/8")
+	if err := validateConfig(&app.config); err != nil {
+		t.Fatal(err)
+	}
+	app.logger = jsonlog.NewLogger(&logs, jsonlog.LevelInfo)
+
+	router := newPatternRouter()
+	router.HandlerFunc(http.MethodGet, "/v1/movies", func(w http.ResponseWriter, r *http.Request) {})
+	handler := app.logRequest(router, app.authenticate(app.rateLimit(router, router)))
+
+	request := func(remoteAddr, forwardedFor string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	// 两个客户端经过同一个负载均衡器，分别计数
+	if request("10.0.0.1:5000", "198.51.100.1") != http.StatusOK || request("10.0.0.1:5000", "198.51.100.2") != http.StatusOK {
+		t.Error("want clients behind the proxy limited separately")
+	}
+	if request("10.0.0.1:5000", "198.51.100.1") != http.StatusTooManyRequests {
+		t.Error("want the same client behind the proxy limited")
+	}
+	if !strings.Contains(logs.String(), `"remote_ip":"198.51.100.2"`) {
+		t.Errorf("want forwarded client IP in access log; got %s", logs.String())
+	}
+
+	// 不可信的对端不能通过伪造请求头绕过限流
+	if request("203.0.113.5:5000", "198.51.100.3") != http.StatusOK || request("203.0.113.5:5000", "198.51.100.4") != http.StatusTooManyRequests {
+		t.Error("want spoofed X-Forwarded-For from an untrusted peer ignored")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	configFile "DesignMode/GreenLight/internal/config"
+	"DesignMode/GreenLight/internal/jsonlog"
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// TODO 该文件存储运行时配置的热加载：收到SIGHUP或配置文件变化时重新加载配置，
+// 只有可以安全替换的配置项（限流、日志等级、CORS、可信代理）会立即生效，其余配置项需要重启
+
+// liveConfig 返回当前生效的配置。热加载后中间件通过它读取新的限流和CORS配置，
+// 没有启用热加载时（如测试中）返回启动时的配置。
+func (app *application) liveConfig() *config {
+	if cfg := app.live.Load(); cfg != nil {
+		return cfg
+	}
+	return &app.config
+}
+
+// configReloader 重新加载配置并原子地替换生效的配置
+type configReloader struct {
+	app    *application
+	loader *configFile.Loader
+	loaded *config // loader绑定的配置，只在持有mu时读写
+	mu     sync.Mutex
+}
+
+// newConfigReloader 创建热加载器，loaded为loader绑定的配置结构体
+func (app *application) newConfigReloader(loader *configFile.Loader, loaded *config) *configReloader {
+	live := app.config
+	app.live.Store(&live)
+	return &configReloader{app: app, loader: loader, loaded: loaded}
+}
+
+// start 在收到SIGHUP或配置文件变化时重新加载配置，ctx结束时停止
+func (cr *configReloader) start(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				cr.reload("SIGHUP")
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return cr.loader.Watch(ctx, func() {
+		cr.reload("file")
+	})
+}
+
+// reload 重新加载配置。新配置无效时保留当前配置并记录错误；
+// 不能热加载的配置项发生变化时只记录日志，重启后才会生效。
+func (cr *configReloader) reload(trigger string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	app := cr.app
+	err := cr.loader.Reload()
+	if err == nil {
+		err = validateConfig(cr.loaded)
+	}
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"trigger": trigger,
+			"action":  "configuration reload rejected, keeping current configuration",
+		})
+		return
+	}
+
+	current := app.liveConfig()
+	next := *current
+	changed := applyReloadable(&next, cr.loaded)
+
+	// 将新配置中可热加载的部分替换为当前值后比较，不同说明有需要重启的改动
+	restart := *cr.loaded
+	applyReloadable(&restart, current)
+	needsRestart := !reflect.DeepEqual(restart, *current)
+
+	properties := map[string]string{
+		"trigger": trigger,
+		"changed": strings.Join(changed, ","),
+	}
+	if needsRestart {
+		properties["restart_required"] = "true"
+	}
+
+	// 按新旧日志等级中较低的一个输出重新加载的记录
+	level, _ := jsonlog.ParseLevel(next.logLevel)
+	if level < app.logger.Level() {
+		app.logger.SetLevel(level)
+		app.logger.PrintInfo("configuration reloaded", properties)
+	} else {
+		app.logger.PrintInfo("configuration reloaded", properties)
+		app.logger.SetLevel(level)
+	}
+
+	app.live.Store(&next)
+}
+
+// applyReloadable 将src中可热加载的配置项复制到dst，返回发生变化的配置项
+func applyReloadable(dst, src *config) []string {
+	var changed []string
+	check := func(key string, equal bool) {
+		if !equal {
+			changed = append(changed, key)
+		}
+	}
+
+	check("log.level", dst.logLevel == src.logLevel)
+	check("trusted-proxies", reflect.DeepEqual(dst.trustedProxies, src.trustedProxies))
+	check("limiter.rps", dst.limiter.rps == src.limiter.rps)
+	check("limiter.burst", dst.limiter.burst == src.limiter.burst)
+	check("limiter.enabled", dst.limiter.enabled == src.limiter.enabled)
+	check("limiter.policy", reflect.DeepEqual(dst.limiter.policySpecs, src.limiter.policySpecs))
+	check("cors.trusted-origins", reflect.DeepEqual(dst.cors.trustedOrigins, src.cors.trustedOrigins))
+	check("cors.allow-credentials", dst.cors.allowCredentials == src.cors.allowCredentials)
+	check("cors.max-age", dst.cors.maxAge == src.cors.maxAge)
+
+	dst.logLevel = src.logLevel
+	dst.trustedProxies = src.trustedProxies
+	dst.trustedProxyNets = src.trustedProxyNets
+	dst.limiter.rps = src.limiter.rps
+	dst.limiter.burst = src.limiter.burst
+	dst.limiter.enabled = src.limiter.enabled
+	dst.limiter.policySpecs = src.limiter.policySpecs
+	dst.limiter.policies = src.limiter.policies
+	dst.cors = src.cors
+	return changed
+}
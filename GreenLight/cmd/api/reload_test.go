@@ -0,0 +1,154 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/jsonlog"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 可以并发写入的日志缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newReloadTestApplication 使用临时配置文件创建application和热加载器
+func newReloadTestApplication(t *testing.T, contents string) (*application, *configReloader, string, *syncBuffer) {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "greenlight.yaml")
+	if err := os.WriteFile(file, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := new(config)
+	loader := newConfigLoader(loaded, nil)
+	loader.SetGetenv(func(string) string { return "" })
+	if err := loader.Load([]string{"-config", file}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateConfig(loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := &syncBuffer{}
+	app := newTestApplication(t)
+	app.config = *loaded
+	app.logger = jsonlog.NewLogger(logs, jsonlog.LevelInfo)
+
+	return app, app.newConfigReloader(loader, loaded), file, logs
+}
+
+// TestConfigReload 测试热加载只替换可以安全修改的配置项，无效的配置被拒绝
+func TestConfigReload(t *testing.T) {
+	app, cr, file, logs := newReloadTestApplication(t, `
+db:
+  dsn: "test"
+limiter:
+  rps: 1
+  burst: 1
+`)
+
+	// 限流器的突发值为1，第二个请求被拒绝
+	handler := app.authenticate(app.rateLimit(newPatternRouter(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	request := func() int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr.Code
+	}
+	if request() != http.StatusOK || request() != http.StatusTooManyRequests {
+		t.Fatal("want the second request to be rate limited")
+	}
+
+	err := os.WriteFile(file, []byte(`
+port: 5000
+log:
+  level: error
+db:
+  dsn: "test"
+limiter:
+  rps: 100
+  burst: 10
+cors:
+  trusted-origins: ["https://www.example.com"]
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.reload("test")
+
+	live := app.liveConfig()
+	if live.limiter.rps != 100 || live.limiter.burst != 10 || len(live.cors.trustedOrigins) != 1 {
+		t.Errorf("want reloadable settings applied; got limiter %+v, cors %+v", live.limiter, live.cors)
+	}
+	if live.port != app.config.port {
+		t.Errorf("want port to require a restart; got %d", live.port)
+	}
+	if app.logger.Level() != jsonlog.LevelError {
+		t.Errorf("want log level error; got %s", app.logger.Level())
+	}
+	out := logs.String()
+	if !strings.Contains(out, `"changed":"log.level,limiter.rps,limiter.burst,cors.trusted-origins"`) || !strings.Contains(out, `"restart_required":"true"`) {
+		t.Errorf("unexpected reload log %s", out)
+	}
+
+	// 已有客户端的限流器也使用新的突发值
+	if request() != http.StatusOK {
+		t.Error("want the existing client to use the reloaded limiter settings")
+	}
+
+	// 无效的配置被拒绝，保留当前配置
+	if err := os.WriteFile(file, []byte("db:\n  dsn: \"test\"\nlimiter:\n  rps: -1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cr.reload("test")
+	if app.liveConfig().limiter.rps != 100 {
+		t.Errorf("want invalid configuration to be rejected; got rps %v", app.liveConfig().limiter.rps)
+	}
+	if !strings.Contains(logs.String(), "limiter.rps: must be greater than zero") {
+		t.Errorf("want rejected reload to be logged; got %s", logs.String())
+	}
+}
+
+// TestConfigReloadOnFileChange 测试配置文件变化后自动热加载
+func TestConfigReloadOnFileChange(t *testing.T) {
+	app, cr, file, _ := newReloadTestApplication(t, "db:\n  dsn: \"test\"\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cr.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(file, []byte("db:\n  dsn: \"test\"\nlimiter:\n  enabled: false\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for app.liveConfig().limiter.enabled {
+		if time.Now().After(deadline) {
+			t.Fatal("want configuration reloaded after the file changed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
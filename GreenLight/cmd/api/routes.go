@@ -1,14 +1,13 @@
 package main
 
 import (
-	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
 // 路由配置文件（将所有的路由相关内容写到这个文件）
 func (app *application) routes() http.Handler {
-	// 创建一个路由实例（使用httprouter中的对应函数）
-	router := httprouter.New()
+	// 创建一个路由实例（使用httprouter中的对应函数，同时记录路由模式，用于指标、限流分组和追踪）
+	router := newPatternRouter()
 
 	// 配置路由未找到时的处理函数
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
@@ -16,18 +15,76 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	// 配置路由
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)       // 列出电影信息的处理函数。
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler) // 健康检查端点的处理函数。
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)     // 创建电影信息的处理函数。
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)    // 显示电影信息的处理函数。
+	// 电影接口需要movies:read或movies:write权限，通过viewer、editor角色或直接授予（不兼容的变更，见CHANGELOG.md）
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))    // 列出电影信息的处理函数。
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)                                    // 健康检查端点的处理函数。
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.livenessHandler)                                  // 存活检查的处理函数。
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.healthcheckHandler)                              // 就绪检查的处理函数。
+	router.HandlerFunc(http.MethodGet, "/v1/version", app.versionHandler)                                            // 版本和构建信息的处理函数。
+	router.HandlerFunc(http.MethodGet, "/.well-known/jwks.json", app.jwksHandler)                                    // 发布JWT公钥的处理函数。
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler)) // 创建电影信息的处理函数。
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler)) // 显示电影信息的处理函数。
 	//router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.updateMovieHandler) // 更新电影信息的处理函数（Put全更新）。
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.updateMovieHandler)  // 更新电影信息的处理函数（Patch部分更新）。
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler) // 删除电影信息的处理函数。
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))  // 更新电影信息的处理函数（Patch部分更新）。
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler)) // 删除电影信息的处理函数。
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)          // 注册用户的处理函数。
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler) // 激活用户的处理函数。
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)               // 注册用户的处理函数。
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)      // 激活用户的处理函数。
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler) // 重置用户密码的处理函数。
 
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler) // 创建认证令牌的处理函数。
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/2fa", app.createTwoFactorAuthenticationTokenHandler)   // 两步验证第二步的处理函数。
+
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/:provider/start", app.startOAuthHandler)       // 开始社交登录的处理函数。
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/:provider/callback", app.oauthCallbackHandler) // 社交登录回调的处理函数。
+
+	// 两步验证和API密钥的管理不能使用API密钥
+	router.HandlerFunc(http.MethodPost, "/v1/users/2fa", app.requireActivatedUser(app.requireUserCredential(app.enrollTwoFactorHandler)))         // 登记两步验证的处理函数。
+	router.HandlerFunc(http.MethodPut, "/v1/users/2fa/confirm", app.requireActivatedUser(app.requireUserCredential(app.confirmTwoFactorHandler))) // 确认两步验证的处理函数。
+	router.HandlerFunc(http.MethodDelete, "/v1/users/2fa", app.requireActivatedUser(app.requireUserCredential(app.disableTwoFactorHandler)))      // 关闭两步验证的处理函数。
+
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireActivatedUser(app.requireUserCredential(app.createAPIKeyHandler)))       // 创建API密钥的处理函数。
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireActivatedUser(app.listAPIKeysHandler))                                    // 列出API密钥的处理函数。
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireActivatedUser(app.requireUserCredential(app.revokeAPIKeyHandler))) // 吊销API密钥的处理函数。
+
+	// 管理员接口：角色、权限、用户角色分配和审计日志
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions", app.requirePermission("roles:admin", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/permissions", app.requirePermission("roles:admin", app.createPermissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("roles:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/roles", app.requirePermission("roles:admin", app.createRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles/:id", app.requirePermission("roles:admin", app.showRoleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/roles/:id", app.requirePermission("roles:admin", app.updateRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/roles/:id", app.requirePermission("roles:admin", app.deleteRoleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("roles:admin", app.assignRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role_id", app.requirePermission("roles:admin", app.unassignRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit-log", app.requirePermission("roles:admin", app.listAuditLogHandler))
+
+	// 管理员接口：用户管理
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/users/:id", app.requirePermission("users:admin", app.updateUserStatusHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id", app.requirePermission("users:admin", app.deleteUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermission("users:admin", app.resetUserPasswordHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.revokeUserPermissionHandler))
+
+	// 管理员接口：发件箱
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails", app.requirePermission("emails:admin", app.listEmailsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails/:id", app.requirePermission("emails:admin", app.showEmailHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/emails/:id/retry", app.requirePermission("emails:admin", app.retryEmailHandler))
+
+	// 应用指标（需要metrics:view权限，抓取程序可以使用API密钥）
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.requirePermission("metrics:view", app.expvarHandler))
+	router.HandlerFunc(http.MethodGet, "/metrics", app.requirePermission("metrics:view", app.prometheusHandler))
+
+	// 创建一个collectMetrics中间件，用于采集请求指标
+	// 创建一个logRequest中间件，用于分配请求ID并输出访问日志
+	// 创建一个traceRequest中间件，用于创建请求的追踪span
+	// 创建一个strictTransportSecurity中间件，用于在HTTPS下添加HSTS响应头
 	// 创建一个recoverPanic中间件，用于处理程序恐慌
-	// 创建一个rateLimit中间件，用于限制请求速率
-	return app.recoverPanic(app.rateLimit(router))
+	// 创建一个enableCORS中间件，用于处理跨域请求（预检请求不计入限流）
+	// 创建一个limitCredentials中间件，用于在认证之前按IP限制携带凭证的请求（包括无效的凭证）
+	// 创建一个authenticate中间件，用于识别当前请求的用户
+	// 创建一个rateLimit中间件，用于按路由分组和用户限制请求速率
+	return app.collectMetrics(router, app.logRequest(router, app.traceRequest(router, app.strictTransportSecurity(app.recoverPanic(app.enableCORS(app.limitCredentials(router, app.authenticate(app.rateLimit(router, router)))))))))
 }
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRoutes 测试所有路由都能注册成功（httprouter在路由冲突时会panic），并且未知路由返回404
+func TestRoutes(t *testing.T) {
+	app := newTestApplication(t)
+
+	handler := app.routes()
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/does-not-exist", nil)
+	handler.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d; got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
 
+// 关闭服务器后导出剩余span的最长时间，不计入shutdown-timeout
+const traceFlushTimeout = 5 * time.Second
+
 func (app *application) serve() error {
 	// 创建一个http.Server结构体
 	srv := &http.Server{
@@ -20,16 +25,52 @@ func (app *application) serve() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
-	// 创建一个通道，用于接收优雅关闭的错误信号
+
+	// 提供了证书时使用HTTPS，证书文件变化时自动重新加载
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	useTLS := app.config.tls.certFile != ""
+	if useTLS {
+		certs, err := newCertReloader(app.config.tls.certFile, app.config.tls.keyFile)
+		if err != nil {
+			return err
+		}
+		if err := app.watchCertificate(ctx, certs); err != nil {
+			return err
+		}
+		srv.TLSConfig = newTLSConfig(certs.getCertificate)
+	}
+
+	// 投递发件箱中的邮件，收到关闭信号后停止领取新邮件，未投递的邮件留在数据库中
+	mailCtx, stopMail := context.WithCancel(context.Background())
+	defer stopMail()
+	if app.config.mail.workers > 0 {
+		app.background(func() {
+			app.runMailWorkers(mailCtx)
+		})
+	}
+
+	// 可选的HTTP监听，将所有请求重定向到HTTPS
+	var redirectSrv *http.Server
+	if useTLS && app.config.tls.redirectPort != 0 {
+		redirectSrv = &http.Server{
+			Addr:         fmt.Sprintf("0.0.0.0:%d", app.config.tls.redirectPort),
+			Handler:      http.HandlerFunc(app.redirectToHTTPS),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 5 * time.Second,
+		}
+	}
+
+	// 创建一个通道，用于接收优雅关闭的结果（成功时为nil）
 	shutdownError := make(chan error, 1)
 
-	// 创建一个goroutine，用于处理SIGINT和SIGTERM信号，并记录任何错误。
+	// 在监听端口之前注册信号，避免启动过程中收到的SIGTERM直接结束进程
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	// 创建一个goroutine，用于处理SIGINT和SIGTERM信号
 	go func() {
-		// 创建一个通道，用于接收信号
-		quit := make(chan os.Signal, 1)
-		// 使用signal.Notify()函数注册quit通道以接收SIGINT和SIGTERM信号。
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-		// 创建一个通道，用于接收信号
 		s := <-quit
 
 		// 使用app.logger.PrintInfo()记录接收到的信号。
@@ -37,35 +78,64 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
-		// 创建一个带有超时的上下文，并调用srv.Shutdown()方法来关闭服务器。
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+		// 就绪检查开始返回503，等待负载均衡器摘除实例后再停止接收请求
+		app.draining.Store(true)
+		if app.config.shutdownDelay > 0 {
+			app.logger.PrintInfo("draining before shutdown", map[string]string{
+				"delay": app.config.shutdownDelay.String(),
+			})
+			time.Sleep(app.config.shutdownDelay)
+		}
 
-		// 使用srv.Shutdown()方法关闭服务器，并记录任何错误。
-		// 利用优雅的关闭，它不会中断任何活动连接的服务器。首先关闭所有打开的侦听器，然后关闭所有空闲的连接，然后无限期地等待连接恢复到空闲状态，然后关闭。
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
+		// 重定向请求不需要等待，直接关闭
+		if redirectSrv != nil {
+			_ = redirectSrv.Close()
 		}
+		// 正在投递的邮件作为后台任务等待完成
+		stopMail()
+		shutdownError <- app.shutdown(srv)
+	}()
 
-		//app.wg.Wait()
-		//shutdownError <- nil
+	// 先监听端口再启动服务，端口为0时可以从日志中得到实际监听的地址
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
 
-		//// 使用app.logger.PrintInfo()记录接收到的信号。
-		//app.logger.PrintInfo("caught signal", map[string]string{
-		//	"signal": s.String(),
-		//})
-		//// 退出程序
-		//os.Exit(0)
-	}()
+	if redirectSrv != nil {
+		redirectLn, err := net.Listen("tcp", redirectSrv.Addr)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		app.logger.PrintInfo("starting https redirect", map[string]string{
+			"addr": redirectLn.Addr().String(),
+		})
+		go func() {
+			err := redirectSrv.Serve(redirectLn)
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{"addr": redirectSrv.Addr})
+			}
+		}()
+	}
+
+	app.logger.PrintInfo("starting server", map[string]string{
+		"addr": ln.Addr().String(),
+		"env":  app.config.env,
+		"tls":  strconv.FormatBool(useTLS),
+	})
 
-	// 使用srv.ListenAndServe()方法启动服务器，并记录任何错误。
-	err := srv.ListenAndServe()
+	// 使用srv.Serve()方法启动服务器（HTTPS使用srv.ServeTLS()，证书来自TLSConfig），优雅关闭时返回http.ErrServerClosed
+	if useTLS {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
-	// 创建一个goroutine，用于等待服务器关闭，并记录任何错误。
+	// 等待优雅关闭完成
 	err = <-shutdownError
 	if err != nil {
 		return err
@@ -78,3 +148,50 @@ func (app *application) serve() error {
 
 	return nil
 }
+
+// shutdown 优雅关闭服务器：停止监听，等待正在处理的请求和后台任务完成，
+// 两者共用 shutdown-timeout 的期限。超过期限仍未完成的后台任务会被放弃并记录数量。
+func (app *application) shutdown(srv *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+	defer cancel()
+
+	// 利用优雅的关闭，它不会中断任何活动连接的服务器。首先关闭所有打开的侦听器，然后关闭所有空闲的连接，然后等待连接恢复到空闲状态。
+	err := srv.Shutdown(ctx)
+
+	app.logger.PrintInfo("completing background tasks", map[string]string{
+		"addr":    srv.Addr,
+		"pending": strconv.FormatInt(app.backgroundTasks.Load(), 10),
+	})
+
+	abandoned := app.waitBackground(ctx)
+	if abandoned > 0 {
+		app.logger.PrintError(errors.New("shutdown deadline exceeded, abandoning background tasks"), map[string]string{
+			"abandoned": strconv.FormatInt(abandoned, 10),
+		})
+	}
+
+	// 后台任务（如发送邮件）也会创建span，因此最后导出剩余的span
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer flushCancel()
+	if traceErr := app.tracer.Shutdown(flushCtx); traceErr != nil {
+		app.logger.PrintError(traceErr, nil)
+	}
+
+	return err
+}
+
+// waitBackground 等待所有后台任务完成，ctx结束时返回仍在运行的任务数
+func (app *application) waitBackground(ctx context.Context) int64 {
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+		return app.backgroundTasks.Load()
+	}
+}
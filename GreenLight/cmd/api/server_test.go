@@ -0,0 +1,115 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/jsonlog"
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestShutdownHelperProcess 不是真正的测试，而是TestGracefulShutdown启动的子进程：
+// 启动一个后台任务后运行服务器，直到收到信号
+func TestShutdownHelperProcess(t *testing.T) {
+	if os.Getenv("GREENLIGHT_SHUTDOWN_HELPER") != "1" {
+		return
+	}
+
+	app := newTestApplication(t)
+	app.logger = jsonlog.NewLogger(os.Stdout, jsonlog.LevelInfo)
+	app.config.port = 0
+	app.config.shutdownTimeout, _ = time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	taskDuration, _ := time.ParseDuration(os.Getenv("TASK_DURATION"))
+
+	app.background(func() {
+		time.Sleep(taskDuration)
+		app.logger.PrintInfo("background task finished", nil)
+	})
+
+	if err := app.serve(); err != nil {
+		app.logger.PrintError(err, nil)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// TestGracefulShutdown 向子进程发送SIGTERM，检查后台任务在期限内完成，或超过期限时被放弃并报告数量
+func TestGracefulShutdown(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM is not supported on windows")
+	}
+	if testing.Short() {
+		t.Skip("starts a child process")
+	}
+
+	tests := []struct {
+		name          string
+		taskDuration  string
+		timeout       string
+		wantFinished  bool
+		wantAbandoned string
+	}{
+		{"drains background tasks", "300ms", "5s", true, ""},
+		{"abandons background tasks after deadline", "1m", "200ms", false, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownHelperProcess$")
+			cmd.Env = append(os.Environ(),
+				"GREENLIGHT_SHUTDOWN_HELPER=1",
+				"SHUTDOWN_TIMEOUT="+tt.timeout,
+				"TASK_DURATION="+tt.taskDuration,
+			)
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer cmd.Process.Kill()
+
+			messages := make(map[string]map[string]string)
+			scanner := bufio.NewScanner(stdout)
+			for scanner.Scan() {
+				var entry struct {
+					Message    string            `json:"message"`
+					Properties map[string]string `json:"properties"`
+				}
+				if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+					continue
+				}
+				messages[entry.Message] = entry.Properties
+
+				// 服务器开始监听后发送SIGTERM
+				if entry.Message == "starting server" {
+					if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if err := cmd.Wait(); err != nil {
+				t.Fatalf("want clean exit; got %v (logs: %v)", err, messages)
+			}
+
+			for _, msg := range []string{"starting server", "shutting down server", "completing background tasks", "stopped server"} {
+				if _, ok := messages[msg]; !ok {
+					t.Errorf("want log message %q; got %v", msg, messages)
+				}
+			}
+			if _, ok := messages["background task finished"]; ok != tt.wantFinished {
+				t.Errorf("want background task finished = %t; got logs %v", tt.wantFinished, messages)
+			}
+			abandoned := messages["shutdown deadline exceeded, abandoning background tasks"]["abandoned"]
+			if abandoned != tt.wantAbandoned {
+				t.Errorf("want %q abandoned tasks; got %q", tt.wantAbandoned, abandoned)
+			}
+		})
+	}
+}
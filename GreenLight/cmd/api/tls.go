@@ -0,0 +1,111 @@
+package main
+
+import (
+	configFile "DesignMode/GreenLight/internal/config"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// TODO 该文件存储HTTPS相关的功能：证书的加载和自动重新加载、TLS配置、HTTP到HTTPS的重定向和HSTS
+
+// certReloader 持有当前使用的证书，证书或私钥文件变化时重新加载，便于不重启服务轮换证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// newCertReloader 加载证书和私钥，文件无效时返回错误
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// reload 重新读取证书和私钥，失败时继续使用原来的证书
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	cr.cert.Store(&cert)
+	return nil
+}
+
+// getCertificate 用作tls.Config.GetCertificate，每次握手使用最新加载的证书
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.cert.Load(), nil
+}
+
+// watchCertificate 在证书或私钥文件变化时重新加载证书，ctx结束时停止。
+// 证书和私钥通常不会同时写入，新证书与旧私钥不匹配时记录错误并等待下一次变化。
+func (app *application) watchCertificate(ctx context.Context, cr *certReloader) error {
+	return configFile.WatchFiles(ctx, []string{cr.certFile, cr.keyFile}, func() {
+		if err := cr.reload(); err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"action": "keeping current certificate",
+			})
+			return
+		}
+		app.logger.PrintInfo("tls certificate reloaded", map[string]string{
+			"cert": cr.certFile,
+		})
+	})
+}
+
+// newTLSConfig 返回只允许TLS 1.2及以上版本的配置：TLS 1.2只使用支持前向保密的AEAD加密套件，
+// 优先使用X25519和P-256曲线。TLS 1.3的加密套件由Go自动选择。
+func newTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		GetCertificate: getCertificate,
+	}
+}
+
+// redirectToHTTPS 将HTTP请求永久重定向到HTTPS端口上的相同地址，308保留请求方法和请求体
+func (app *application) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if app.config.port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(app.config.port))
+	}
+
+	target := "https://" + host + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
+
+// strictTransportSecurity 在启用HTTPS和HSTS时添加Strict-Transport-Security响应头，
+// 浏览器在max-age内只会通过HTTPS访问。
+func (app *application) strictTransportSecurity(next http.Handler) http.Handler {
+	if app.config.tls.certFile == "" || app.config.tls.hstsMaxAge <= 0 {
+		return next
+	}
+
+	value := "max-age=" + strconv.Itoa(int(app.config.tls.hstsMaxAge.Seconds()))
+	if app.config.tls.hstsIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert 生成序列号为serial的localhost自签名证书，写入dir下的cert.pem和key.pem
+func writeSelfSignedCert(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 先写入临时文件再重命名，避免读取到写了一半的证书
+	write := func(name, blockType string, data []byte) string {
+		path := filepath.Join(dir, name)
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keyFile = write("key.pem", "EC PRIVATE KEY", keyDER)
+	certFile = write("cert.pem", "CERTIFICATE", der)
+	return certFile, keyFile
+}
+
+// TestCertificateReload 测试HTTPS服务使用安全的TLS配置，证书文件替换后新的连接使用新证书
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, 1)
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApplication(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := app.watchCertificate(ctx, certs); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", newTLSConfig(certs.getCertificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler:  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		ErrorLog: log.New(io.Discard, "", 0), // 握手失败是预期的
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	// 返回服务端证书的序列号，握手失败时返回错误
+	serial := func(clientConfig *tls.Config) (int64, error) {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+	}
+
+	if got, err := serial(&tls.Config{InsecureSkipVerify: true}); err != nil || got != 1 {
+		t.Fatalf("want certificate 1; got %d, %v", got, err)
+	}
+	if _, err := serial(&tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11}); err == nil {
+		t.Error("want TLS 1.1 handshake to be rejected")
+	}
+	if _, err := serial(&tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+		CipherSuites:       []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA},
+	}); err == nil {
+		t.Error("want CBC cipher suite to be rejected")
+	}
+
+	writeSelfSignedCert(t, dir, 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := serial(&tls.Config{InsecureSkipVerify: true})
+		if err == nil && got == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want reloaded certificate 2; got %d, %v", got, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 无效的证书文件不影响当前证书
+	if err := os.WriteFile(certFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if got, err := serial(&tls.Config{InsecureSkipVerify: true}); err != nil || got != 2 {
+		t.Errorf("want certificate 2 kept after an invalid update; got %d, %v", got, err)
+	}
+}
+
+// TestRedirectToHTTPS 测试HTTP请求被重定向到HTTPS端口上的相同地址
+func TestRedirectToHTTPS(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		port int
+		url  string
+		want string
+	}{
+		{4443, "http://example.com:8080/v1/movies?page=2", "https://example.com:4443/v1/movies?page=2"},
+		{443, "http://example.com/v1/healthcheck", "https://example.com/v1/healthcheck"},
+		{4443, "http://[::1]:8080/", "https://[::1]:4443/"},
+	}
+
+	for _, tt := range tests {
+		app.config.port = tt.port
+		rr := httptest.NewRecorder()
+		app.redirectToHTTPS(rr, httptest.NewRequest(http.MethodPost, tt.url, nil))
+
+		if rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != tt.want {
+			t.Errorf("%s: want 308 to %s; got %d to %s", tt.url, tt.want, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
+
+// TestStrictTransportSecurity 测试只有启用HTTPS和HSTS时才发送Strict-Transport-Security
+func TestStrictTransportSecurity(t *testing.T) {
+	app := newTestApplication(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	header := func() string {
+		rr := httptest.NewRecorder()
+		app.strictTransportSecurity(next).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr.Header().Get("Strict-Transport-Security")
+	}
+
+	app.config.tls.hstsMaxAge = 365 * 24 * time.Hour
+	if got := header(); got != "" {
+		t.Errorf("want no HSTS without TLS; got %q", got)
+	}
+
+	app.config.tls.certFile = "cert.pem"
+	app.config.tls.hstsIncludeSubdomains = true
+	if got := header(); got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("unexpected HSTS header %q", got)
+	}
+}
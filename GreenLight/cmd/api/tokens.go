@@ -0,0 +1,156 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/validator"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 创建认证令牌 createAuthenticationTokenHandler
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// 声明结构体 input
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	// 读取JSON请求体数据到input结构体中
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// 校验邮箱和密码
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 取出客户端的IP地址（经过可信代理时使用代理转发的地址）
+	ip := app.clientIP(r)
+
+	// 账户或IP处于退避或锁定状态时，直接拒绝，不再校验密码
+	if wait := app.loginGuard.allow(input.Email, ip); wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
+	// 通过邮箱查找用户，找不到时返回401
+	user, err := app.models.WithContext(r.Context()).Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.loginFailed(r, input.Email, ip, nil)
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 校验密码是否匹配
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		app.loginFailed(r, input.Email, ip, user)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// 启用了两步验证时，只签发一个短期的2fa-pending令牌
+	if app.requireSecondFactor(w, r, user) {
+		return
+	}
+
+	// 登录成功，清除账户的失败记录
+	app.loginGuard.succeed(input.Email)
+
+	token, err := app.issueAuthenticationToken(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requireSecondFactor 用户启用了两步验证时签发一个短期的2fa-pending令牌并返回202，
+// 客户端需要携带该令牌和验证码请求 POST /v1/tokens/2fa 才能获得认证令牌。
+// 返回true表示响应已经写出，调用方不能再签发认证令牌。
+func (app *application) requireSecondFactor(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	tf, err := app.models.WithContext(r.Context()).TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+	if tf == nil || !tf.Enabled {
+		return false
+	}
+
+	pending, err := app.models.WithContext(r.Context()).Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactorPending)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+
+	env := envelope{"two_factor_required": true, "pending_token": pending}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+	return true
+}
+
+// issueAuthenticationToken 根据认证模式为用户签发认证令牌
+func (app *application) issueAuthenticationToken(r *http.Request, user *data.User) (*data.Token, error) {
+	switch app.config.auth.mode {
+	case authModeJWT:
+		// JWT中携带权限，后续请求无需再查询数据库
+		permissions, err := app.models.WithContext(r.Context()).Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return app.newJWT(user, permissions)
+	default:
+		// 生成令牌，并设置其过期时间为24小时，并使用 ScopeAuthentication 作为作用域
+		return app.models.WithContext(r.Context()).Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	}
+}
+
+// loginFailed 记录一次登录失败，账户因此被锁定时向用户发送通知邮件
+func (app *application) loginFailed(r *http.Request, email, ip string, user *data.User) {
+	locked := app.loginGuard.fail(email, ip)
+	if !locked || user == nil {
+		return
+	}
+
+	app.logger.PrintInfo("account locked after failed logins", map[string]string{
+		"user_id": strconv.FormatInt(user.ID, 10),
+		"ip":      ip,
+	})
+
+	mailData := map[string]interface{}{
+		"ip":             ip,
+		"lockoutMinutes": int(app.config.lockout.duration.Minutes()),
+	}
+	// 只有一次写入，不需要事务
+	err := app.queueMail(app.models.WithContext(r.Context()), user, "account_locked.tmpl", mailData)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+	app.notifyMailQueued()
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/totp"
+	"DesignMode/GreenLight/internal/validator"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// TODO 该文件存储TOTP两步验证的登记、确认、关闭和第二步登录相关的处理函数
+
+// totpIssuer 认证器应用中显示的签发者名称
+const totpIssuer = "Greenlight"
+
+// 登记两步验证 enrollTwoFactorHandler
+// 生成新的TOTP密钥（未确认前不会生效），并返回认证器应用使用的provisioning URI
+func (app *application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// JWT中的用户信息不包含邮箱，需要从数据库中获取
+	user, err := app.models.WithContext(r.Context()).Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tf, err := app.models.WithContext(r.Context()).TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if tf != nil && tf.Enabled {
+		v := validator.New()
+		v.AddError("two_factor", "two-factor authentication is already enabled")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.WithContext(r.Context()).TwoFactor.SetPending(user.ID, secret)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Email, secret),
+	}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 确认两步验证 confirmTwoFactorHandler
+// 使用认证器应用生成的第一个验证码确认登记，成功后启用两步验证并返回恢复码
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	tf, err := app.models.WithContext(r.Context()).TwoFactor.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("two_factor", "you must enroll before confirming two-factor authentication")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if tf.Enabled {
+		v.AddError("two_factor", "two-factor authentication is already enabled")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 记录确认使用的验证码，登录时不能再次使用
+	ok, err := app.verifyTOTP(r, tf, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v.AddError("code", "invalid verification code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 启用两步验证，恢复码明文只返回这一次
+	codes, err := app.models.WithContext(r.Context()).TwoFactor.Enable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 关闭两步验证 disableTwoFactorHandler（需要提供有效的验证码或恢复码）
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// JWT中的用户信息不包含邮箱，需要从数据库中获取（登录防护按邮箱统计失败次数）
+	user, err := app.models.WithContext(r.Context()).Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 与登录相同，错误的验证码计入失败次数，防止通过该接口猜测验证码
+	ip := app.clientIP(r)
+	if wait := app.loginGuard.allow(user.Email, ip); wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
+	tf, err := app.models.WithContext(r.Context()).TwoFactor.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	ok, err := app.verifySecondFactor(r, v, tf, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !ok {
+		app.loginFailed(r, user.Email, ip, user)
+		v.AddError("code", "invalid verification code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	app.loginGuard.succeed(user.Email)
+
+	err = app.models.WithContext(r.Context()).TwoFactor.Disable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// 第二步登录 createTwoFactorAuthenticationTokenHandler
+// 使用2fa-pending令牌和验证码（或恢复码）换取真正的认证令牌
+func (app *application) createTwoFactorAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		PendingToken string `json:"pending_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.PendingToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 获取2fa-pending令牌对应的用户
+	user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopeTwoFactorPending, input.PendingToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("pending_token", "invalid or expired two-factor token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 错误的验证码与错误的密码一样计入登录失败次数
+	ip := app.clientIP(r)
+	if wait := app.loginGuard.allow(user.Email, ip); wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
+	tf, err := app.models.WithContext(r.Context()).TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if tf == nil || !tf.Enabled {
+		v.AddError("pending_token", "invalid or expired two-factor token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(r, v, tf, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !ok {
+		app.loginFailed(r, user.Email, ip, user)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// 2fa-pending令牌只能使用一次
+	err = app.models.WithContext(r.Context()).Tokens.DeleteAllForUser(data.ScopeTwoFactorPending, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 登录成功，清除账户的失败记录
+	app.loginGuard.succeed(user.Email)
+
+	token, err := app.issueAuthenticationToken(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifySecondFactor 校验TOTP验证码或恢复码（二选一），格式错误时向v中添加错误
+func (app *application) verifySecondFactor(r *http.Request, v *validator.Validator, tf *data.TwoFactor, code, recoveryCode string) (bool, error) {
+	switch {
+	case code != "" && recoveryCode != "":
+		v.AddError("code", "must provide either code or recovery_code, not both")
+		return false, nil
+	case recoveryCode != "":
+		return app.models.WithContext(r.Context()).TwoFactor.UseRecoveryCode(tf.UserID, recoveryCode)
+	default:
+		if data.ValidateTOTPCode(v, code); !v.Valid() {
+			return false, nil
+		}
+		return app.verifyTOTP(r, tf, code)
+	}
+}
+
+// verifyTOTP 校验TOTP验证码，并记录验证码的时间步数：每个验证码只能使用一次，
+// 早于最后一次使用的验证码的验证码也不再接受
+func (app *application) verifyTOTP(r *http.Request, tf *data.TwoFactor, code string) (bool, error) {
+	counter, ok := totp.ValidateCounter(tf.Secret, code, time.Now())
+	if !ok || counter <= tf.LastCounter {
+		return false, nil
+	}
+	return app.models.WithContext(r.Context()).TwoFactor.UseCounter(tf.UserID, counter)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/totp"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestVerifyTOTPReplay 测试验证码被接受后记录其时间步数，同一个验证码和更早的验证码不能再次使用
+func TestVerifyTOTPReplay(t *testing.T) {
+	app := newTestApplication(t)
+
+	db := &execDB{}
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() { conn.Close() })
+	app.models = data.NewModels(conn)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := totp.Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/v1/tokens/2fa", nil)
+
+	tf := &data.TwoFactor{UserID: 7, Secret: secret, Enabled: true}
+	ok, err := app.verifyTOTP(r, tf, code)
+	if err != nil || !ok {
+		t.Fatalf("want fresh code accepted; got %v %v", ok, err)
+	}
+	update, found := db.find("SET last_counter = ?")
+	if !found {
+		t.Fatal("want the accepted counter recorded")
+	}
+	counter := uint64(update.args[0].(int64))
+
+	// 数据库中已记录该时间步数：同一个验证码和上一个时间步的验证码都被拒绝
+	tf.LastCounter = counter
+	previous, _ := totp.Code(secret, now.Add(-totp.Period))
+	for _, replay := range []string{code, previous} {
+		if ok, err := app.verifyTOTP(r, tf, replay); err != nil || ok {
+			t.Errorf("want code %s rejected after counter %d was used; got %v %v", replay, counter, ok, err)
+		}
+	}
+}
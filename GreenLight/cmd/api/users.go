@@ -2,9 +2,11 @@ package main
 
 import (
 	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/mailer"
 	"DesignMode/GreenLight/internal/validator"
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,6 +17,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Language string `json:"language"` // 邮件使用的语言，为空时根据Accept-Language选择
 	}
 
 	// 读取JSON请求体数据到input结构体中
@@ -28,6 +31,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Language:  mailer.MatchLanguage(r.Header.Get("Accept-Language")),
 	}
 
 	// 使用 Password.Set() 方法设置密码（加密）
@@ -39,14 +43,40 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 	v := validator.New()
 
+	// 指定的语言必须有对应的邮件模板
+	if input.Language != "" {
+		language, ok := mailer.ParseLanguage(input.Language)
+		v.Check(ok, "language", "must be one of "+strings.Join(mailer.Languages(), ", "))
+		user.Language = language
+	}
+
 	// 使用 ValidateUser() 方法对用户数据进行验证
 	if data.ValidateUser(v, user); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	// 调用 Users.Insert() 方法将用户插入数据库
-	err = app.models.Users.Insert(user)
+	// TODO 在同一个事务中插入用户、激活令牌和激活邮件，写入发件箱失败时用户也不会被创建，客户端可以重新注册
+	// 激活邮件由后台worker投递并在失败时重试，SMTP不可用或进程重启都不会丢失邮件
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		// 调用 Users.Insert() 方法将用户插入数据库
+		err := tx.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+
+		// 生成令牌，并设置其过期时间为3天，并使用 ScopeActivation 作为作用域
+		token, err := tx.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		mailData := map[string]interface{}{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+		return app.queueMail(tx, user, "user_welcome.tmpl", mailData)
+	})
 	if err != nil {
 		switch {
 		// 如果是 ErrDuplicateEmail，则说明该邮箱已经被注册，因此返回一个错误响应
@@ -58,13 +88,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-
-	// 生成令牌，并设置其过期时间为3天，并使用 ScopeActivation 作为作用域
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
+	app.notifyMailQueued()
 
 	// TODO 发送激活邮件相关代码
 	// ‘background’ goroutine将发送欢迎邮件，这个代码将被并发执行，我们不需在等待邮件发送！
@@ -82,16 +106,13 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	//}()
 
 	// TODO 直接调用封装的background()函数，来捕获程序崩溃
-	app.background(func() {
-		data := map[string]interface{}{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
-		}
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-	})
+	//app.background(func() {
+	//	data := map[string]interface{}{
+	//		"activationToken": token.Plaintext,
+	//		"userID":          user.ID,
+	//	}
+	//	app.sendMail(r.Context(), user.Email, "user_welcome.tmpl", data)
+	//})
 
 	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
 	if err != nil {
@@ -123,7 +144,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// 获取包含用户记录的 Token 记录
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -135,11 +156,17 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// 被管理员停用的账户不能通过未使用的激活令牌重新启用
+	if !user.PendingActivation() {
+		app.inactiveAccountResponse(w, r)
+		return
+	}
+
 	// 将用户记录的 Activated 字段设置为 true
 	user.Activated = true
 
 	// 更新用户记录
-	err = app.models.Users.Update(user)
+	err = app.models.WithContext(r.Context()).Users.Update(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -151,7 +178,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// 删除所有与用户关联的令牌记录
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.models.WithContext(r.Context()).Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -162,3 +189,74 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// 通过重置令牌设置新密码 updateUserPasswordHandler
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// 声明结构体 input
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	// 读取JSON请求体数据到input结构体中
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// 校验新密码和重置令牌
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 获取重置令牌对应的用户
+	user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 设置新密码
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.WithContext(r.Context()).Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 重置令牌只能使用一次
+	err = app.models.WithContext(r.Context()).Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 重置密码后解除账户锁定
+	app.loginGuard.reset(user.Email)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/data"
+	"DesignMode/GreenLight/internal/mailer"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// execDB 测试数据库，记录每条执行语句及其参数，LastInsertId递增。
+// 事务的提交和回滚记录为COMMIT和ROLLBACK语句；failOn不为空时，包含failOn的语句返回错误；
+// noRows不为空时，包含noRows的执行语句影响0行。
+// 查询语句返回rows中键（语句片段）包含在语句中的结果，键为空切片时没有结果行，找不到对应的键时返回错误
+type execDB struct {
+	mu      sync.Mutex
+	lastID  int64
+	execs   []execRecord
+	failOn  string
+	noRows  string
+	rows    map[string][][]driver.Value
+	queries []execRecord
+}
+
+type execRecord struct {
+	query string
+	args  []driver.Value
+}
+
+func (db *execDB) Connect(context.Context) (driver.Conn, error) { return execConn{db}, nil }
+func (db *execDB) Driver() driver.Driver                        { return nil }
+
+// find 返回第一条包含substr的语句
+func (db *execDB) find(substr string) (execRecord, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, rec := range db.execs {
+		if strings.Contains(rec.query, substr) {
+			return rec, true
+		}
+	}
+	return execRecord{}, false
+}
+
+type execConn struct{ db *execDB }
+
+func (c execConn) Prepare(query string) (driver.Stmt, error) { return execStmt{c.db, query}, nil }
+func (c execConn) Close() error                              { return nil }
+func (c execConn) Begin() (driver.Tx, error)                 { return execTx{c.db}, nil }
+
+type execTx struct{ db *execDB }
+
+func (tx execTx) Commit() error   { tx.db.record("COMMIT"); return nil }
+func (tx execTx) Rollback() error { tx.db.record("ROLLBACK"); return nil }
+
+// record 记录一条没有参数的语句
+func (db *execDB) record(query string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.execs = append(db.execs, execRecord{query: query})
+}
+
+type execStmt struct {
+	db    *execDB
+	query string
+}
+
+func (s execStmt) Close() error  { return nil }
+func (s execStmt) NumInput() int { return -1 }
+
+func (s execStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if s.db.failOn != "" && strings.Contains(s.query, s.db.failOn) {
+		return nil, errors.New("exec failed")
+	}
+	s.db.lastID++
+	s.db.execs = append(s.db.execs, execRecord{query: s.query, args: args})
+	if s.db.noRows != "" && strings.Contains(s.query, s.db.noRows) {
+		return execResult{id: s.db.lastID}, nil
+	}
+	return execResult{id: s.db.lastID, affected: 1}, nil
+}
+
+func (s execStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.queries = append(s.db.queries, execRecord{query: s.query, args: args})
+	for substr, rows := range s.db.rows {
+		if strings.Contains(s.query, substr) {
+			return &execRows{rows: rows}, nil
+		}
+	}
+	return nil, errors.New("queries not supported")
+}
+
+type execResult struct{ id, affected int64 }
+
+func (r execResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r execResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// execRows 查询结果，列数取自第一行
+type execRows struct{ rows [][]driver.Value }
+
+func (r *execRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *execRows) Close() error { return nil }
+
+func (r *execRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newTestMailer 创建使用内置模板的Mailer
+func newTestMailer(t *testing.T, transport mailer.Transport, sender string) mailer.Mailer {
+	t.Helper()
+
+	m, err := mailer.New(transport, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// queuedEmail 返回写入发件箱的第一封邮件
+func queuedEmail(t *testing.T, db *execDB) *data.Email {
+	t.Helper()
+
+	insert, ok := db.find("INSERT INTO emails")
+	if !ok {
+		t.Fatal("want an email written to the outbox")
+	}
+	email := &data.Email{ID: 1, Attempts: 1, Recipient: insert.args[1].(string), Template: insert.args[2].(string), Language: insert.args[3].(string)}
+	if err := json.Unmarshal([]byte(insert.args[4].(string)), &email.Data); err != nil {
+		t.Fatal(err)
+	}
+	return email
+}
+
+// TestRegisterUserSendsActivationEmail 测试注册用户时将激活邮件写入发件箱，投递的邮件包含写入数据库的激活令牌
+func TestRegisterUserSendsActivationEmail(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := mailer.NewMemory()
+	app.mailer = newTestMailer(t, outbox, "Greenlight <no-reply@greenlight.test>")
+
+	db := &execDB{}
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() { conn.Close() })
+	app.models = data.NewModels(conn)
+
+	body := `{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}`
+	rr := httptest.NewRecorder()
+	app.registerUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("want 202; got %d %s", rr.Code, rr.Body)
+	}
+	if app.metrics.mailQueued.Value() != 1 || len(outbox.Messages()) != 0 {
+		t.Fatal("want the email queued in the outbox, not sent by the handler")
+	}
+	if _, ok := db.find("COMMIT"); !ok {
+		t.Fatal("want the user, activation token and email committed together")
+	}
+
+	// 模拟worker投递领取到的邮件
+	app.deliverEmail(queuedEmail(t, db))
+
+	messages := outbox.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("want 1 activation email; got %d", len(messages))
+	}
+	msg := messages[0]
+	if len(msg.To) != 1 || msg.To[0] != "alice@example.com" || msg.Template != "user_welcome.tmpl" || !strings.Contains(msg.Subject, "Welcome to Greenlight!") {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	// 邮件中的令牌必须是写入数据库的激活令牌
+	match := regexp.MustCompile(`"token": "([A-Z2-7]{26})"`).FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("want activation token in the plain body; got %s", msg.PlainBody)
+	}
+	insert, ok := db.find("INSERT INTO tokens")
+	if !ok {
+		t.Fatal("want activation token inserted")
+	}
+	hash := sha256.Sum256([]byte(match[1]))
+	if insert.args[0] != string(hash[:]) {
+		t.Error("want the emailed token to match the stored token hash")
+	}
+	if insert.args[3] != data.ScopeActivation {
+		t.Errorf("want activation scope; got %v", insert.args[3])
+	}
+	if !strings.Contains(msg.PlainBody, "user ID number is 1.") {
+		t.Errorf("want the new user's ID in the email; got %s", msg.PlainBody)
+	}
+	if app.metrics.mailSent.Value() != 1 {
+		t.Errorf("want mail sent metric incremented; got %v", app.metrics.mailSent.Value())
+	}
+	if _, ok := db.find("SET status = ?, sent_at = ?"); !ok {
+		t.Error("want the email marked as sent")
+	}
+}
+
+// TestRegisterUserOutboxFailure 测试写入发件箱失败时回滚用户和激活令牌，客户端可以使用同一个邮箱重新注册
+func TestRegisterUserOutboxFailure(t *testing.T) {
+	app := newTestApplication(t)
+	app.mailer = newTestMailer(t, mailer.NewMemory(), "no-reply@greenlight.test")
+
+	db := &execDB{failOn: "INSERT INTO emails"}
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() { conn.Close() })
+	app.models = data.NewModels(conn)
+
+	body := `{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}`
+	rr := httptest.NewRecorder()
+	app.registerUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("want 500; got %d %s", rr.Code, rr.Body)
+	}
+
+	if _, ok := db.find("INSERT INTO users"); !ok {
+		t.Fatal("want the user inserted in the transaction")
+	}
+	if _, ok := db.find("COMMIT"); ok {
+		t.Error("want the transaction not committed")
+	}
+	if _, ok := db.find("ROLLBACK"); !ok {
+		t.Error("want the user and activation token rolled back")
+	}
+	if app.metrics.mailQueued.Value() != 0 {
+		t.Error("want no email counted as queued")
+	}
+}
+
+// TestRegisterUserLanguage 测试用户的语言来自注册请求或Accept-Language，并用于激活邮件
+func TestRegisterUserLanguage(t *testing.T) {
+	tests := []struct {
+		name           string
+		language       string
+		acceptLanguage string
+		wantStatus     int
+		wantLanguage   string
+		wantSubject    string
+	}{
+		{"default", "", "", http.StatusAccepted, "en", "Welcome to Greenlight!"},
+		{"accept-language", "", "zh-TW,zh;q=0.9,en;q=0.8", http.StatusAccepted, "zh-CN", "欢迎加入Greenlight！"},
+		{"explicit language wins", "en", "zh-CN", http.StatusAccepted, "en", "Welcome to Greenlight!"},
+		{"explicit language normalized", "zh-cn", "", http.StatusAccepted, "zh-CN", "欢迎加入Greenlight！"},
+		{"unsupported language", "fr", "", http.StatusUnprocessableEntity, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			outbox := mailer.NewMemory()
+			app.mailer = newTestMailer(t, outbox, "no-reply@greenlight.test")
+
+			db := &execDB{}
+			conn := sql.OpenDB(db)
+			t.Cleanup(func() { conn.Close() })
+			app.models = data.NewModels(conn)
+
+			body := `{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234", "language": "` + tt.language + `"}`
+			r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+			rr := httptest.NewRecorder()
+			app.registerUserHandler(rr, r)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("want %d; got %d %s", tt.wantStatus, rr.Code, rr.Body)
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				return
+			}
+
+			insert, _ := db.find("INSERT INTO users")
+			if insert.args[5] != tt.wantLanguage {
+				t.Errorf("want user language %s; got %v", tt.wantLanguage, insert.args[5])
+			}
+
+			app.deliverEmail(queuedEmail(t, db))
+			messages := outbox.Messages()
+			if len(messages) != 1 || !strings.Contains(messages[0].Subject, tt.wantSubject) {
+				t.Errorf("want subject %q; got %+v", tt.wantSubject, messages)
+			}
+		})
+	}
+}
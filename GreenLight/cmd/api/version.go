@@ -0,0 +1,43 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/vcs"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// TODO 该文件存储版本和构建信息的输出：-version命令行参数和 GET /v1/version
+
+// printVersion 以文本格式输出构建信息
+func printVersion(w io.Writer, info vcs.Info) {
+	fmt.Fprintf(w, "greenlight %s\n", info.Version)
+
+	commit := info.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	if info.Dirty {
+		commit += " (dirty)"
+	}
+	fmt.Fprintf(w, "commit:     %s\n", commit)
+	if info.BuildTime != "" {
+		fmt.Fprintf(w, "build time: %s\n", info.BuildTime)
+	}
+	fmt.Fprintf(w, "go:         %s\n", info.GoVersion)
+
+	if len(info.Dependencies) > 0 {
+		fmt.Fprintln(w, "dependencies:")
+		for _, dep := range info.Dependencies {
+			fmt.Fprintf(w, "  %s %s\n", dep.Path, dep.Version)
+		}
+	}
+}
+
+// versionHandler 返回版本号、提交、构建时间、Go版本和依赖模块的版本
+func (app *application) versionHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"build_info": vcs.Read(version)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
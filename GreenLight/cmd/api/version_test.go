@@ -0,0 +1,58 @@
+package main
+
+import (
+	"DesignMode/GreenLight/internal/vcs"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestPrintVersion 测试-version的输出格式
+func TestPrintVersion(t *testing.T) {
+	var out bytes.Buffer
+	printVersion(&out, vcs.Info{
+		Version:      "1.2.3",
+		Commit:       "abc123",
+		Dirty:        true,
+		BuildTime:    "2024-01-02T03:04:05Z",
+		GoVersion:    "go1.20",
+		Dependencies: []vcs.Module{{Path: "github.com/julienschmidt/httprouter", Version: "v1.3.0"}},
+	})
+
+	for _, want := range []string{
+		"greenlight 1.2.3\n",
+		"commit:     abc123 (dirty)\n",
+		"build time: 2024-01-02T03:04:05Z\n",
+		"go:         go1.20\n",
+		"  github.com/julienschmidt/httprouter v1.3.0\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want output containing %q; got\n%s", want, out.String())
+		}
+	}
+}
+
+// TestVersionHandler 测试 GET /v1/version 返回版本号和Go版本
+func TestVersionHandler(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/version", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want 200; got %d", rr.Code)
+	}
+
+	var res struct {
+		BuildInfo vcs.Info `json:"build_info"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.BuildInfo.Version != version || res.BuildInfo.GoVersion != runtime.Version() {
+		t.Errorf("unexpected build info %+v", res.BuildInfo)
+	}
+}
@@ -2,30 +2,397 @@ package config
 
 import (
 	"bytes"
-	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/spf13/viper"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var AppConf *viper.Viper
+// TODO 分层的配置加载：默认值 < 配置文件 < 环境变量（GREENLIGHT_*） < 命令行参数。
+// 每个配置项用一个key注册（如 db.max-open-conns），对应配置文件中的 db: max-open-conns:，
+// 环境变量 GREENLIGHT_DB_MAX_OPEN_CONNS 和命令行参数 -db-max-open-conns。
 
-// 初始化配置文件
-func InitConfig(f embed.FS) {
-	AppConf = viper.New()
-	//添加根路径
-	dir := "config"
-	// 获取目录的文件名
-	dirEntries, err := f.ReadDir(dir)
-	if err != nil {
-		fmt.Println("错误", err.Error())
+// EnvPrefix 环境变量前缀
+const EnvPrefix = "GREENLIGHT_"
+
+// redacted 打印配置时代替敏感值
+const redacted = "REDACTED"
+
+// Source 配置值的来源
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// value 可以从字符串设置、并能恢复默认值的配置值
+type value interface {
+	flag.Value
+	reset()
+}
+
+// Option 一个已注册的配置项
+type Option struct {
+	key    string
+	value  value
+	secret bool
+	source Source
+}
+
+// Secret 将配置项标记为敏感信息，打印配置时不显示其值
+func (o *Option) Secret() *Option {
+	o.secret = true
+	return o
+}
+
+// Loader 分层的配置加载器
+type Loader struct {
+	flags      *flag.FlagSet
+	options    []*Option
+	byKey      map[string]*Option
+	configPath string
+	fallback   []byte
+	file       string   // 实际读取的配置文件（内置配置时为空）
+	setFlags   []setArg // 命令行中出现的参数，按出现顺序
+	getenv     func(string) string
+}
+
+// setArg 一个命令行参数的原始值
+type setArg struct {
+	option *Option
+	value  string
+}
+
+// NewLoader 创建加载器。fallback为未指定 -config 时使用的内置配置文件内容（YAML），可以为nil。
+func NewLoader(name string, fallback []byte) *Loader {
+	l := &Loader{
+		flags:    flag.NewFlagSet(name, flag.ContinueOnError),
+		byKey:    make(map[string]*Option),
+		fallback: fallback,
+		getenv:   os.Getenv,
+	}
+	l.flags.StringVar(&l.configPath, "config", "", "Path of a YAML/JSON/TOML config file (env "+EnvPrefix+"CONFIG)")
+	return l
+}
+
+// FlagSet 返回底层的FlagSet，用于注册不参与分层的命令行参数（如 -print-config）
+func (l *Loader) FlagSet() *flag.FlagSet {
+	return l.flags
+}
+
+// SetGetenv 替换读取环境变量的函数（用于测试）
+func (l *Loader) SetGetenv(getenv func(string) string) {
+	l.getenv = getenv
+}
+
+// register 注册配置项，同时注册对应的命令行参数
+func (l *Loader) register(key string, v value, usage string) *Option {
+	if _, exists := l.byKey[key]; exists {
+		panic("config: duplicate key " + key)
+	}
+	o := &Option{key: key, value: v, source: SourceDefault}
+	l.options = append(l.options, o)
+	l.byKey[key] = o
+
+	usage = fmt.Sprintf("%s (env %s)", usage, EnvName(key))
+	l.flags.Var(&flagRecorder{loader: l, option: o}, FlagName(key), usage)
+	return o
+}
+
+// String 注册字符串配置项
+func (l *Loader) String(p *string, key, def, usage string) *Option {
+	*p = def
+	return l.register(key, &stringValue{p: p, def: def}, usage)
+}
+
+// Int 注册整数配置项
+func (l *Loader) Int(p *int, key string, def int, usage string) *Option {
+	*p = def
+	return l.register(key, &intValue{p: p, def: def}, usage)
+}
+
+// Float64 注册浮点数配置项
+func (l *Loader) Float64(p *float64, key string, def float64, usage string) *Option {
+	*p = def
+	return l.register(key, &float64Value{p: p, def: def}, usage)
+}
+
+// Bool 注册布尔配置项
+func (l *Loader) Bool(p *bool, key string, def bool, usage string) *Option {
+	*p = def
+	return l.register(key, &boolValue{p: p, def: def}, usage)
+}
+
+// Duration 注册时间间隔配置项（如 15m、1h30m）
+func (l *Loader) Duration(p *time.Duration, key string, def time.Duration, usage string) *Option {
+	*p = def
+	return l.register(key, &durationValue{p: p, def: def}, usage)
+}
+
+// Fields 注册以空格分隔的字符串列表（配置文件中也可以使用YAML列表）
+func (l *Loader) Fields(p *[]string, key string, def []string, usage string) *Option {
+	*p = def
+	return l.register(key, &fieldsValue{p: p, def: def}, usage)
+}
+
+// List 注册可重复的字符串列表：命令行参数可以出现多次，环境变量以分号分隔，配置文件中使用YAML列表
+func (l *Loader) List(p *[]string, key, usage string) *Option {
+	*p = nil
+	return l.register(key, &listValue{p: p}, usage)
+}
+
+// Load 解析命令行参数，并依次应用配置文件、环境变量和命令行参数
+func (l *Loader) Load(args []string) error {
+	if err := l.flags.Parse(args); err != nil {
+		return err
+	}
+	if l.flags.NArg() > 0 {
+		return fmt.Errorf("config: unexpected arguments %q", l.flags.Args())
+	}
+	return l.apply()
+}
+
+// Reload 重新读取配置文件和环境变量，命令行参数仍然优先
+func (l *Loader) Reload() error {
+	return l.apply()
+}
+
+// File 返回读取的配置文件路径，使用内置配置时返回空字符串
+func (l *Loader) File() string {
+	return l.file
+}
+
+// apply 从默认值开始依次应用各层配置
+func (l *Loader) apply() error {
+	for _, o := range l.options {
+		o.value.reset()
+		o.source = SourceDefault
+	}
+
+	if err := l.applyFile(); err != nil {
+		return err
+	}
+
+	for _, o := range l.options {
+		if val, ok := l.lookupEnv(EnvName(o.key)); ok {
+			if err := l.set(o, SourceEnv, val); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, arg := range l.setFlags {
+		if err := l.set(arg.option, SourceFlag, arg.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFile 读取配置文件（-config 或 GREENLIGHT_CONFIG，都未指定时使用内置配置）
+func (l *Loader) applyFile() error {
+	path := l.configPath
+	if path == "" {
+		path = l.getenv(EnvPrefix + "CONFIG")
+	}
+
+	v := viper.New()
+	switch {
+	case path != "":
+		ext := strings.TrimPrefix(filepath.Ext(path), ".")
+		if ext == "yml" {
+			ext = "yaml"
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		v.SetConfigType(ext)
+		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+		l.file = path
+	case l.fallback != nil:
+		v.SetConfigType("yaml")
+		if err := v.ReadConfig(bytes.NewReader(l.fallback)); err != nil {
+			return fmt.Errorf("config: built-in config: %w", err)
+		}
+		l.file = ""
+	default:
+		return nil
+	}
+
+	for _, key := range v.AllKeys() {
+		o, ok := l.byKey[key]
+		if !ok {
+			return fmt.Errorf("config: unknown key %q in config file", key)
+		}
+		if err := l.setFromFile(o, v.Get(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFromFile 将配置文件中的值（字符串、数字、布尔值或列表）应用到配置项
+func (l *Loader) setFromFile(o *Option, raw interface{}) error {
+	items, isList := raw.([]interface{})
+	if !isList {
+		return l.set(o, SourceFile, fmt.Sprint(raw))
+	}
+
+	if _, ok := o.value.(*listValue); ok {
+		for _, item := range items {
+			if err := l.set(o, SourceFile, fmt.Sprint(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, fmt.Sprint(item))
 	}
-	for _, de := range dirEntries {
-		if !de.IsDir() {
-			file, _ := f.ReadFile(dir + "/" + de.Name())
-			// 如果你的配置文件没有写扩展名，那么这里需要声明你的配置文件属于什么格式
-			AppConf.SetConfigType("yaml")
-			_ = AppConf.MergeConfig(bytes.NewBuffer(file))
+	return l.set(o, SourceFile, strings.Join(parts, " "))
+}
+
+// lookupEnv 读取环境变量，空字符串视为未设置
+func (l *Loader) lookupEnv(name string) (string, bool) {
+	val := l.getenv(name)
+	return val, val != ""
+}
+
+// set 设置配置项的值，来自更高一层时先恢复默认值（列表不会与低层的值合并）
+func (l *Loader) set(o *Option, source Source, val string) error {
+	if o.source != source {
+		o.value.reset()
+		o.source = source
+	}
+
+	if _, ok := o.value.(*listValue); ok && source == SourceEnv {
+		for _, item := range strings.Split(val, ";") {
+			if item = strings.TrimSpace(item); item != "" {
+				if err := o.value.Set(item); err != nil {
+					return fmt.Errorf("config: %s (%s): %w", o.key, source, err)
+				}
+			}
 		}
+		return nil
 	}
 
+	if err := o.value.Set(val); err != nil {
+		return fmt.Errorf("config: %s (%s): %w", o.key, source, err)
+	}
+	return nil
+}
+
+// Print 按注册顺序以 key: value # 来源 的格式输出生效的配置，敏感值被隐藏
+func (l *Loader) Print(w io.Writer) error {
+	var buf bytes.Buffer
+	if l.file != "" {
+		fmt.Fprintf(&buf, "# config file: %s\n", l.file)
+	}
+	for _, o := range l.options {
+		fmt.Fprintf(&buf, "%s: %s # %s\n", o.key, l.display(o), o.source)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// display 返回打印用的值
+func (l *Loader) display(o *Option) string {
+	switch v := o.value.(type) {
+	case *fieldsValue:
+		return quoteList(*v.p, o.secret)
+	case *listValue:
+		return quoteList(*v.p, o.secret)
+	}
+
+	val := o.value.String()
+	if o.secret && val != "" {
+		val = redacted
+	}
+	if _, ok := o.value.(*stringValue); ok || o.secret {
+		return fmt.Sprintf("%q", val)
+	}
+	return val
+}
+
+// quoteList 将列表格式化为YAML行内列表
+func quoteList(items []string, secret bool) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		if secret {
+			item = redacted
+		}
+		quoted[i] = fmt.Sprintf("%q", item)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// FlagName 返回配置项对应的命令行参数名（db.max-open-conns -> db-max-open-conns）
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, ".", "-")
+}
+
+// EnvName 返回配置项对应的环境变量名（db.max-open-conns -> GREENLIGHT_DB_MAX_OPEN_CONNS）
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// flagRecorder 先记录命令行参数的原始值，在应用完配置文件和环境变量之后再设置
+type flagRecorder struct {
+	loader *Loader
+	option *Option
+}
+
+func (f *flagRecorder) String() string {
+	if f.option == nil {
+		return ""
+	}
+	return f.option.value.String()
+}
+
+func (f *flagRecorder) Set(s string) error {
+	// 先校验格式，让格式错误在解析命令行时就报告出来
+	if err := validate(f.option.value, s); err != nil {
+		return err
+	}
+	f.loader.setFlags = append(f.loader.setFlags, setArg{option: f.option, value: s})
+	return nil
+}
+
+// IsBoolFlag 让布尔参数可以不带值（-limiter-enabled）
+func (f *flagRecorder) IsBoolFlag() bool {
+	_, ok := f.option.value.(*boolValue)
+	return ok
+}
+
+// validate 检查字符串能否解析为配置项的类型
+func validate(v value, s string) error {
+	var err error
+	switch v.(type) {
+	case *intValue:
+		_, err = strconv.Atoi(s)
+	case *float64Value:
+		_, err = strconv.ParseFloat(s, 64)
+	case *boolValue:
+		_, err = strconv.ParseBool(s)
+	case *durationValue:
+		_, err = time.ParseDuration(s)
+	}
+	if err != nil {
+		return errors.New("parse error")
+	}
+	return nil
 }
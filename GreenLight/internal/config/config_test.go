@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig 测试用的配置
+type testConfig struct {
+	port      int
+	dsn       string
+	rps       float64
+	enabled   bool
+	idle      time.Duration
+	origins   []string
+	providers []string
+}
+
+func newTestLoader(cfg *testConfig, fallback string, env map[string]string) *Loader {
+	var fb []byte
+	if fallback != "" {
+		fb = []byte(fallback)
+	}
+	l := NewLoader("test", fb)
+	l.SetGetenv(func(key string) string { return env[key] })
+
+	l.Int(&cfg.port, "port", 4000, "port")
+	l.String(&cfg.dsn, "db.dsn", "", "dsn").Secret()
+	l.Float64(&cfg.rps, "limiter.rps", 2, "rps")
+	l.Bool(&cfg.enabled, "limiter.enabled", true, "enabled")
+	l.Duration(&cfg.idle, "db.max-idle-time", 15*time.Minute, "idle")
+	l.Fields(&cfg.origins, "cors.trusted-origins", nil, "origins")
+	l.List(&cfg.providers, "oauth.provider", "providers").Secret()
+	return l
+}
+
+// TestLoadPrecedence 测试 默认值 < 配置文件 < 环境变量 < 命令行参数
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "greenlight.yaml")
+	err := os.WriteFile(file, []byte(`
+port: 5000
+db:
+  dsn: "file-dsn"
+  max-idle-time: 5m
+limiter:
+  rps: 10
+cors:
+  trusted-origins: ["https://a.example.com", "https://b.example.com"]
+oauth:
+  provider:
+    - "name=file"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"GREENLIGHT_LIMITER_RPS":     "20",
+		"GREENLIGHT_OAUTH_PROVIDER":  "name=env1; name=env2",
+		"GREENLIGHT_LIMITER_ENABLED": "false",
+	}
+
+	var cfg testConfig
+	l := newTestLoader(&cfg, "port: 1", env)
+	err = l.Load([]string{"-config", file, "-limiter-enabled", "-oauth-provider", "name=flag1", "-oauth-provider", "name=flag2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testConfig{
+		port:      5000,
+		dsn:       "file-dsn",
+		rps:       20,
+		enabled:   true,
+		idle:      5 * time.Minute,
+		origins:   []string{"https://a.example.com", "https://b.example.com"},
+		providers: []string{"name=flag1", "name=flag2"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("want %+v; got %+v", want, cfg)
+	}
+	if l.File() != file {
+		t.Errorf("want config file %q; got %q", file, l.File())
+	}
+
+	// 重新加载时命令行参数仍然优先，环境变量的变化生效
+	env["GREENLIGHT_LIMITER_RPS"] = "30"
+	delete(env, "GREENLIGHT_OAUTH_PROVIDER")
+	if err := l.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.rps != 30 || !cfg.enabled || len(cfg.providers) != 2 {
+		t.Errorf("unexpected config after reload %+v", cfg)
+	}
+}
+
+// TestLoadFallback 测试未指定配置文件时使用内置配置，环境变量中的列表以分号分隔
+func TestLoadFallback(t *testing.T) {
+	var cfg testConfig
+	l := newTestLoader(&cfg, "port: 1\noauth:\n  provider: [\"name=builtin\"]\n", map[string]string{
+		"GREENLIGHT_OAUTH_PROVIDER": "name=a;name=b",
+	})
+	if err := l.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.port != 1 || !reflect.DeepEqual(cfg.providers, []string{"name=a", "name=b"}) {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+// TestLoadErrors 测试配置文件中的未知key和格式错误的值
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		env      map[string]string
+		args     []string
+		wantErr  string
+	}{
+		{"unknown key", "db:\n  max-idle-conn: 10\n", nil, nil, `unknown key "db.max-idle-conn"`},
+		{"invalid file value", "port: abc\n", nil, nil, "port (file)"},
+		{"invalid env value", "", map[string]string{"GREENLIGHT_DB_MAX_IDLE_TIME": "10"}, nil, "db.max-idle-time (env)"},
+		{"invalid flag value", "", nil, []string{"-limiter-rps", "fast"}, `invalid value "fast" for flag -limiter-rps`},
+		{"missing config file", "", nil, []string{"-config", "does-not-exist.yaml"}, "does-not-exist.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg testConfig
+			l := newTestLoader(&cfg, tt.fallback, tt.env)
+			l.FlagSet().SetOutput(&bytes.Buffer{})
+
+			err := l.Load(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("want error containing %q; got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestPrint 测试打印配置时隐藏敏感值并标明来源
+func TestPrint(t *testing.T) {
+	var cfg testConfig
+	l := newTestLoader(&cfg, "db:\n  dsn: \"root:secret@tcp(localhost)/db\"\n", nil)
+	if err := l.Load([]string{"-oauth-provider", "name=x,client-secret=s", "-cors-trusted-origins", "https://a.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := l.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "secret") {
+		t.Errorf("want secrets redacted; got\n%s", out)
+	}
+	for _, line := range []string{
+		`port: 4000 # default`,
+		`db.dsn: "REDACTED" # file`,
+		`cors.trusted-origins: ["https://a.com"] # flag`,
+		`oauth.provider: ["REDACTED"] # flag`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("want line %q; got\n%s", line, out)
+		}
+	}
+}
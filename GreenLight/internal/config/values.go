@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TODO 该文件存储各种类型的配置值，都实现了flag.Value
+
+type stringValue struct {
+	p   *string
+	def string
+}
+
+func (v *stringValue) Set(s string) error { *v.p = s; return nil }
+func (v *stringValue) String() string     { return *v.p }
+func (v *stringValue) reset()             { *v.p = v.def }
+
+type intValue struct {
+	p   *int
+	def int
+}
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v.p = n
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(*v.p) }
+func (v *intValue) reset()         { *v.p = v.def }
+
+type float64Value struct {
+	p   *float64
+	def float64
+}
+
+func (v *float64Value) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v.p = f
+	return nil
+}
+func (v *float64Value) String() string { return strconv.FormatFloat(*v.p, 'g', -1, 64) }
+func (v *float64Value) reset()         { *v.p = v.def }
+
+type boolValue struct {
+	p   *bool
+	def bool
+}
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v.p = b
+	return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(*v.p) }
+func (v *boolValue) reset()         { *v.p = v.def }
+
+type durationValue struct {
+	p   *time.Duration
+	def time.Duration
+}
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v.p = d
+	return nil
+}
+func (v *durationValue) String() string { return v.p.String() }
+func (v *durationValue) reset()         { *v.p = v.def }
+
+// fieldsValue 以空格分隔的列表，每次设置都替换整个列表
+type fieldsValue struct {
+	p   *[]string
+	def []string
+}
+
+func (v *fieldsValue) Set(s string) error { *v.p = strings.Fields(s); return nil }
+func (v *fieldsValue) String() string     { return strings.Join(*v.p, " ") }
+func (v *fieldsValue) reset()             { *v.p = v.def }
+
+// listValue 可重复的列表，每次设置追加一项
+type listValue struct {
+	p *[]string
+}
+
+func (v *listValue) Set(s string) error { *v.p = append(*v.p, s); return nil }
+func (v *listValue) String() string     { return strings.Join(*v.p, "; ") }
+func (v *listValue) reset()             { *v.p = nil }
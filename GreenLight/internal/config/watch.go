@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"path/filepath"
+	"time"
+)
+
+// 编辑器保存文件时通常会产生多个事件，合并这段时间内的事件只触发一次
+const watchDebounce = 200 * time.Millisecond
+
+// Watch 监听配置文件的变化，文件被修改、替换（包括Kubernetes ConfigMap的符号链接切换）时调用onChange。
+// 使用内置配置时没有文件可以监听，直接返回nil。ctx结束时停止监听。
+func (l *Loader) Watch(ctx context.Context, onChange func()) error {
+	if l.file == "" {
+		return nil
+	}
+	return WatchFiles(ctx, []string{l.file}, onChange)
+}
+
+// WatchFiles 监听一组文件的变化（如TLS证书和私钥），任意文件被修改或替换时调用onChange，
+// 短时间内的多次变化只触发一次。ctx结束时停止监听。
+func WatchFiles(ctx context.Context, files []string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// 监听所在目录而不是文件本身，文件被替换后仍然可以收到事件
+	realFiles := make(map[string]string, len(files))
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return err
+		}
+		realFiles[file], _ = filepath.EvalSymlinks(file)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				changed := false
+				for file, realFile := range realFiles {
+					if filepath.Clean(event.Name) == file && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create)) {
+						changed = true
+					}
+					if current, _ := filepath.EvalSymlinks(file); current != "" && current != realFile {
+						// 符号链接指向了新的文件
+						changed = true
+						realFiles[file] = current
+					}
+				}
+				if !changed {
+					continue
+				}
+				if timer == nil {
+					timer = time.NewTimer(watchDebounce)
+				} else {
+					timer.Reset(watchDebounce)
+				}
+				fire = timer.C
+			case <-fire:
+				fire = nil
+				onChange()
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,312 @@
+package data
+
+import (
+	"DesignMode/GreenLight/internal/validator"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix API密钥明文的前缀，方便在日志和代码仓库中识别泄露的密钥
+const APIKeyPrefix = "gl_"
+
+// APIKey 结构体，用于机器客户端的长期凭证
+type APIKey struct {
+	ID          int64       `json:"id"`
+	Plaintext   string      `json:"key,omitempty"` // 只在创建时返回一次
+	Hash        []byte      `json:"-"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Expiry      *time.Time  `json:"expiry,omitempty"` // 为空表示永不过期
+}
+
+// APIKeyModel 结构体
+type APIKeyModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	ctx      context.Context
+}
+
+// ValidateAPIKeyPlaintext 校验API密钥明文
+func ValidateAPIKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(keyPlaintext != "", "key", "must be provided")
+	v.Check(strings.HasPrefix(keyPlaintext, APIKeyPrefix), "key", "must start with "+APIKeyPrefix)
+	v.Check(len(keyPlaintext) == len(APIKeyPrefix)+52, "key", "must be 55 bytes long")
+}
+
+// ValidateAPIKey 校验API密钥，allowed为当前用户拥有的权限，密钥的权限必须是其子集
+func ValidateAPIKey(v *validator.Validator, key *APIKey, allowed Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range key.Permissions {
+		v.Check(allowed.Include(code), "permissions", "must only contain permissions granted to you")
+	}
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+// New 生成一个新的API密钥并插入数据库
+func (m APIKeyModel) New(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	key, err := generateAPIKey(userID, name, permissions, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(key)
+	return key, err
+}
+
+// Insert 在同一个事务中插入API密钥及其权限
+func (m APIKeyModel) Insert(key *APIKey) error {
+	ctx, cancel := queryContext(m.ctx, "APIKeyModel.Insert")
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO api_keys (hash, user_id, name, created_at, expiry)
+		VALUES (?, ?, ?, ?, ?)
+		`
+
+	result, err := tx.ExecContext(ctx, query, key.Hash, key.UserID, key.Name, key.CreatedAt, key.Expiry)
+	if err != nil {
+		return err
+	}
+	key.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	// 权限必须来自permissions表
+	query = `
+		INSERT INTO api_keys_permissions (api_key_id, permission_id)
+		SELECT ?, permissions.id FROM permissions WHERE permissions.code IN (` + placeholders(len(key.Permissions)) + `)
+		`
+
+	args := []interface{}{key.ID}
+	for _, code := range key.Permissions {
+		args = append(args, code)
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAllForUser 获取用户的所有API密钥（不包含明文）
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT api_keys.id, api_keys.name, api_keys.created_at, api_keys.expiry,
+			COALESCE(GROUP_CONCAT(permissions.code ORDER BY permissions.code), '')
+		FROM api_keys
+			LEFT JOIN api_keys_permissions ON api_keys_permissions.api_key_id = api_keys.id
+			LEFT JOIN permissions ON permissions.id = api_keys_permissions.permission_id
+		WHERE api_keys.user_id = ?
+		GROUP BY api_keys.id
+		ORDER BY api_keys.id
+		`
+
+	ctx, cancel := queryContext(m.ctx, "APIKeyModel.GetAllForUser")
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		key := APIKey{UserID: userID}
+		var codes string
+
+		err := rows.Scan(&key.ID, &key.Name, &key.CreatedAt, &key.Expiry, &codes)
+		if err != nil {
+			return nil, err
+		}
+
+		key.Permissions = splitCodes(codes)
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForKey 通过API密钥明文获取对应的用户和密钥权限，过期的密钥视为不存在
+func (m APIKeyModel) GetForKey(keyPlaintext string) (*User, Permissions, error) {
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+
+	query := `
+		SELECT
+			api_keys.id,
+			users.id, users.created_at, users.name, users.email,
+			users.password_hash, users.activated, users.deactivated_at, users.language, users.version
+		FROM       api_keys
+		INNER JOIN users
+			ON users.id = api_keys.user_id
+		WHERE api_keys.hash = ?
+			AND (api_keys.expiry IS NULL OR api_keys.expiry > ?)
+		`
+
+	var (
+		keyID int64
+		user  User
+	)
+
+	ctx, cancel := queryContext(m.ctx, "APIKeyModel.GetForKey")
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:], time.Now()).Scan(
+		&keyID,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DeactivatedAt,
+		&user.Language,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	query = `
+		SELECT permissions.code
+		FROM permissions
+			INNER JOIN api_keys_permissions ON api_keys_permissions.permission_id = permissions.id
+		WHERE api_keys_permissions.api_key_id = ?
+		`
+
+	rows, err := m.DB.QueryContext(ctx, query, keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	// 初始化为空切片而不是nil，表示权限来自密钥本身
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return &user, permissions, nil
+}
+
+// Delete 吊销用户的一个API密钥
+func (m APIKeyModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM api_keys
+		WHERE id = ? AND user_id = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "APIKeyModel.Delete")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	// 判断删除的行数是否为0
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// generateAPIKey 生成一个API密钥，明文为前缀加上32字节随机数的base32编码
+func generateAPIKey(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	key := &APIKey{
+		UserID:      userID,
+		Name:        name,
+		Permissions: permissions,
+		CreatedAt:   time.Now(),
+		Expiry:      expiry,
+	}
+
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Plaintext = APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	// 与Token相同，数据库中只保存sha256哈希值
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	return key, nil
+}
+
+// placeholders 生成n个以逗号分隔的占位符，用于IN查询
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// splitCodes 将GROUP_CONCAT返回的权限字符串拆分为权限列表
+func splitCodes(codes string) Permissions {
+	if codes == "" {
+		return Permissions{}
+	}
+	return strings.Split(codes, ",")
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// AuditEntry 审计日志条目，记录谁在什么时候对什么对象做了什么操作
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ActorID    int64                  `json:"actor_id"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditModel 结构体
+type AuditModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	ctx      context.Context
+}
+
+// Insert 插入一条审计日志
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+
+	entry.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO audit_log (created_at, actor_id, action, target_type, target_id, details)
+		VALUES (?, ?, ?, ?, ?, ?)
+		`
+
+	args := []interface{}{entry.CreatedAt, entry.ActorID, entry.Action, entry.TargetType, entry.TargetID, string(details)}
+
+	ctx, cancel := queryContext(m.ctx, "AuditModel.Insert")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	entry.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetAll 分页获取审计日志，targetType不为空时按对象类型过滤
+func (m AuditModel) GetAll(targetType string, filters Filters) ([]*AuditEntry, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, created_at, actor_id, action, target_type, target_id, details
+		FROM audit_log
+		WHERE target_type = ? OR ? = ''
+		ORDER BY ` + filters.sortColumn() + ` ` + filters.sortDirection() + `, id DESC
+		LIMIT ? OFFSET ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "AuditModel.GetAll")
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, targetType, targetType, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+	entries := []*AuditEntry{}
+
+	for rows.Next() {
+		var (
+			entry   AuditEntry
+			details string
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.TargetType,
+			&entry.TargetID,
+			&details,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal([]byte(details), &entry.Details)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
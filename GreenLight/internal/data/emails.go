@@ -0,0 +1,342 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// 邮件的投递状态
+const (
+	EmailPending = "pending" // 等待投递（包括失败后等待重试）
+	EmailSending = "sending" // 已被worker领取，租约过期后视为投递中断，重新投递
+	EmailSent    = "sent"    // 投递成功
+	EmailDead    = "dead"    // 达到最大尝试次数，不再自动重试
+)
+
+// maxEmailErrorLength last_error列的最大长度
+const maxEmailErrorLength = 1024
+
+// Email 发件箱中的一封邮件。邮件在请求中写入数据库，由后台worker渲染模板并投递
+type Email struct {
+	ID            int64                  `json:"id"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Recipient     string                 `json:"recipient"`
+	Template      string                 `json:"template"`
+	Language      string                 `json:"language"`
+	Data          map[string]interface{} `json:"-"` // 模板数据，可能包含令牌明文，不在接口中返回
+	Status        string                 `json:"status"`
+	Attempts      int                    `json:"attempts"`
+	NextAttemptAt time.Time              `json:"next_attempt_at"`
+	LastError     string                 `json:"last_error,omitempty"`
+	SentAt        *time.Time             `json:"sent_at,omitempty"`
+}
+
+// EmailModel 结构体
+type EmailModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	ctx      context.Context
+	tx       *sql.Tx // 不为nil时在该事务中执行，见Models.Transaction
+}
+
+// Insert 将邮件加入发件箱，立即可以投递
+func (m EmailModel) Insert(email *Email) error {
+	data, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	email.CreatedAt = time.Now()
+	email.Status = EmailPending
+	email.NextAttemptAt = email.CreatedAt
+
+	query := `
+		INSERT INTO emails (created_at, recipient, template, language, data, status, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		`
+
+	args := []interface{}{email.CreatedAt, email.Recipient, email.Template, email.Language, string(data), email.Status, email.NextAttemptAt}
+
+	ctx, cancel := queryContext(m.ctx, "EmailModel.Insert")
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	email.ID, err = result.LastInsertId()
+	return err
+}
+
+// Claim 领取最多limit封到期的邮件，将其标记为投递中并增加尝试次数。
+// 领取的邮件在lease内不会被其他worker（包括其他实例）领取，超过lease仍未完成时重新投递。
+func (m EmailModel) Claim(limit int, lease time.Duration) ([]*Email, error) {
+	ctx, cancel := queryContext(m.ctx, "EmailModel.Claim")
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED：多个worker同时领取时跳过已被锁定的行，而不是等待
+	query := `
+		SELECT id, created_at, recipient, template, language, data, attempts
+		FROM emails
+		WHERE status IN (?, ?) AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+		`
+
+	now := time.Now()
+	rows, err := tx.QueryContext(ctx, query, EmailPending, EmailSending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	emails := []*Email{}
+	for rows.Next() {
+		var (
+			email Email
+			data  string
+		)
+
+		err := rows.Scan(&email.ID, &email.CreatedAt, &email.Recipient, &email.Template, &email.Language, &data, &email.Attempts)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(data), &email.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, &email)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		return emails, nil
+	}
+
+	args := []interface{}{EmailSending, now.Add(lease)}
+	for _, email := range emails {
+		email.Status = EmailSending
+		email.Attempts++
+		email.NextAttemptAt = now.Add(lease)
+		args = append(args, email.ID)
+	}
+
+	query = `
+		UPDATE emails
+		SET status = ?, attempts = attempts + 1, next_attempt_at = ?
+		WHERE id IN (` + placeholders(len(emails)) + `)
+		`
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return emails, tx.Commit()
+}
+
+// MarkSent 将邮件标记为已投递，并清除模板数据（其中可能包含令牌明文）
+func (m EmailModel) MarkSent(id int64) error {
+	query := `
+		UPDATE emails
+		SET status = ?, sent_at = ?, data = '{}', last_error = ''
+		WHERE id = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "EmailModel.MarkSent")
+	defer cancel()
+
+	_, err := m.db().ExecContext(ctx, query, EmailSent, time.Now(), id)
+	return err
+}
+
+// Reschedule 记录投递失败的原因，在nextAttempt之后重试
+func (m EmailModel) Reschedule(id int64, lastError string, nextAttempt time.Time) error {
+	query := `
+		UPDATE emails
+		SET status = ?, next_attempt_at = ?, last_error = ?
+		WHERE id = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "EmailModel.Reschedule")
+	defer cancel()
+
+	_, err := m.db().ExecContext(ctx, query, EmailPending, nextAttempt, truncateError(lastError), id)
+	return err
+}
+
+// MarkDead 记录最后一次投递失败的原因，不再自动重试
+func (m EmailModel) MarkDead(id int64, lastError string) error {
+	query := `
+		UPDATE emails
+		SET status = ?, last_error = ?
+		WHERE id = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "EmailModel.MarkDead")
+	defer cancel()
+
+	_, err := m.db().ExecContext(ctx, query, EmailDead, truncateError(lastError), id)
+	return err
+}
+
+// Retry 将不再自动重试的邮件重新加入发件箱，并重置尝试次数。邮件不是dead状态时返回ErrEditConflict
+func (m EmailModel) Retry(id int64) error {
+	query := `
+		UPDATE emails
+		SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND status = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "EmailModel.Retry")
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, query, EmailPending, time.Now(), id, EmailDead)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+// Get 通过ID获取邮件（不包含模板数据）
+func (m EmailModel) Get(id int64) (*Email, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, recipient, template, language, status, attempts, next_attempt_at, last_error, sent_at
+		FROM emails
+		WHERE id = ?
+		`
+
+	var email Email
+
+	ctx, cancel := queryContext(m.ctx, "EmailModel.Get")
+	defer cancel()
+
+	err := m.db().QueryRowContext(ctx, query, id).Scan(
+		&email.ID,
+		&email.CreatedAt,
+		&email.Recipient,
+		&email.Template,
+		&email.Language,
+		&email.Status,
+		&email.Attempts,
+		&email.NextAttemptAt,
+		&email.LastError,
+		&email.SentAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &email, nil
+}
+
+// GetAll 分页获取发件箱中的邮件（不包含模板数据），status不为空时按状态过滤
+func (m EmailModel) GetAll(status string, filters Filters) ([]*Email, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, created_at, recipient, template, language, status, attempts, next_attempt_at, last_error, sent_at
+		FROM emails
+		WHERE status = ? OR ? = ''
+		ORDER BY ` + filters.sortColumn() + ` ` + filters.sortDirection() + `, id DESC
+		LIMIT ? OFFSET ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "EmailModel.GetAll")
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, status, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+	emails := []*Email{}
+
+	for rows.Next() {
+		var email Email
+
+		err := rows.Scan(
+			&totalRecords,
+			&email.ID,
+			&email.CreatedAt,
+			&email.Recipient,
+			&email.Template,
+			&email.Language,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&email.SentAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return emails, metadata, nil
+}
+
+// truncateError 截断错误信息，避免超过last_error列的长度
+func truncateError(msg string) string {
+	if len(msg) > maxEmailErrorLength {
+		return msg[:maxEmailErrorLength]
+	}
+	return msg
+}
+
+// db 在事务中时返回事务，否则返回连接池
+func (m EmailModel) db() dbtx {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
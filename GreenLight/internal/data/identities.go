@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrDuplicateIdentity 外部身份已经关联到某个用户
+	ErrDuplicateIdentity = errors.New("duplicate identity")
+)
+
+// Identity 外部身份提供方（OpenID Connect）中的账户与本地用户的关联
+type Identity struct {
+	ID        int64
+	UserID    int64
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// IdentityModel 结构体
+type IdentityModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	ctx      context.Context
+}
+
+// Insert 关联一个外部身份
+func (m IdentityModel) Insert(identity *Identity) error {
+	identity.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		`
+
+	args := []interface{}{identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt}
+
+	ctx, cancel := queryContext(m.ctx, "IdentityModel.Insert")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case isDuplicateEntry(err):
+			return ErrDuplicateIdentity
+		default:
+			return err
+		}
+	}
+
+	identity.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetUser 获取外部身份关联的用户，未关联时返回ErrRecordNotFound
+func (m IdentityModel) GetUser(provider, subject string) (*User, error) {
+	query := `
+		SELECT
+			users.id, users.created_at, users.name, users.email,
+			users.password_hash, users.activated, users.deactivated_at, users.language, users.version
+		FROM       users
+		INNER JOIN user_identities
+			ON users.id = user_identities.user_id
+		WHERE user_identities.provider = ?
+			AND user_identities.subject = ?
+		`
+
+	var user User
+
+	ctx, cancel := queryContext(m.ctx, "IdentityModel.GetUser")
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DeactivatedAt,
+		&user.Language,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
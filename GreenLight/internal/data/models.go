@@ -1,10 +1,14 @@
 package data
 
 import (
+	"DesignMode/GreenLight/internal/trace"
+	"context"
 	"database/sql"
 	"errors"
+	"github.com/go-sql-driver/mysql"
 	"log"
 	"os"
+	"time"
 )
 
 var (
@@ -20,6 +24,12 @@ type Models struct {
 	Users       UserModel
 	Tokens      TokenModel
 	Permissions PermissionModel
+	APIKeys     APIKeyModel
+	Roles       RoleModel
+	Audit       AuditModel
+	TwoFactor   TwoFactorModel
+	Identities  IdentityModel
+	Emails      EmailModel
 }
 
 // 创建一个Models结构体，并初始化其中的各个字段。
@@ -48,5 +58,109 @@ func NewModels(db *sql.DB) Models {
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
 		},
+		APIKeys: APIKeyModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Roles: RoleModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Audit: AuditModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		TwoFactor: TwoFactorModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Identities: IdentityModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Emails: EmailModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
 	}
 }
+
+// queryTimeout 每次数据库操作的超时时间
+const queryTimeout = 3 * time.Second
+
+// WithContext 返回使用ctx作为查询父上下文的Models副本。
+// 请求处理函数传入r.Context()后，每次查询的span都会挂在该请求的span之下，客户端断开时查询也会被取消。
+func (m Models) WithContext(ctx context.Context) Models {
+	m.Movies.ctx = ctx
+	m.Users.ctx = ctx
+	m.Tokens.ctx = ctx
+	m.Permissions.ctx = ctx
+	m.APIKeys.ctx = ctx
+	m.Roles.ctx = ctx
+	m.Audit.ctx = ctx
+	m.TwoFactor.ctx = ctx
+	m.Identities.ctx = ctx
+	m.Emails.ctx = ctx
+	return m
+}
+
+// dbtx *sql.DB和*sql.Tx共同的查询方法
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Transaction 在一个数据库事务中执行fn，fn返回错误时回滚，否则提交。
+// 传给fn的Models中Users、Tokens和Emails的操作都在该事务中执行，
+// 例如插入用户、激活令牌和激活邮件要么全部写入，要么全部不写入；其他模型的操作不在事务中。
+func (m Models) Transaction(ctx context.Context, fn func(tx Models) error) error {
+	tx, err := m.Users.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txModels := m.WithContext(ctx)
+	txModels.Users.tx = tx
+	txModels.Tokens.tx = tx
+	txModels.Emails.tx = tx
+
+	err = fn(txModels)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryContext 创建一次数据库操作使用的上下文：在parent（为nil时使用context.Background()）之上
+// 设置超时，并创建一个名为name的客户端span。返回的cancel函数同时结束span。
+func queryContext(parent context.Context, name string) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, span := trace.Start(parent, name, trace.SpanKindClient)
+	span.SetAttribute("db.system", "mysql")
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	return ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			span.RecordError(ctx.Err())
+		}
+		cancel()
+		span.End()
+	}
+}
+
+// isDuplicateEntry 判断是否为MySQL唯一索引冲突错误（错误码1062）
+func isDuplicateEntry(err error) bool {
+	var mysqlError *mysql.MySQLError
+	return errors.As(err, &mysqlError) && mysqlError.Number == 1062
+}
@@ -44,6 +44,7 @@ type MovieModel struct {
 	DB       *sql.DB
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
+	ctx      context.Context
 }
 
 // 创建一个movie
@@ -53,7 +54,7 @@ func (m MovieModel) Insert(movie *Movie) error {
 		VALUES (?,?,?,?,?) 
 		`
 	// 通过context上下文的延时函数，超时则自动cancel
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "MovieModel.Insert")
 	defer cancel()
 
 	// 执行查询
@@ -77,7 +78,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	var movie Movie
 
 	// 通过context上下文的延时函数，超时则自动cancel
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "MovieModel.Get")
 	defer cancel()
 
 	// 执行查询
@@ -124,7 +125,7 @@ func (m MovieModel) Update(movie *Movie) error {
 
 	// 使用context上下文的延时函数，超时则自动cancel
 	// 当对应的上下文context超时了，PostgreSql driver会发送对应的取消信号给数据库，程序会自动中断对应的查询！
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "MovieModel.Update")
 	defer cancel()
 
 	// 执行查询
@@ -154,7 +155,7 @@ func (m MovieModel) Delete(id int64) error {
 		`
 
 	// 使用context上下文的延时函数，超时则自动cancel
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "MovieModel.Delete")
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -208,7 +209,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	query += fmt.Sprintf(" LIMIT ? OFFSET ?")
 
 	// 通过context上下文的延时函数，超时则自动cancel
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "MovieModel.GetAll")
 	defer cancel()
 
 	// 执行查询
@@ -1,12 +1,29 @@
 package data
 
 import (
+	"DesignMode/GreenLight/internal/validator"
 	"context"
 	"database/sql"
+	"errors"
 	"log"
-	"time"
+	"regexp"
 )
 
+var (
+	// ErrDuplicatePermission 权限代码重复
+	ErrDuplicatePermission = errors.New("duplicate permission")
+
+	// PermissionCodeRX 权限代码的格式，例如 movies:read
+	PermissionCodeRX = regexp.MustCompile(`^[a-z][a-z0-9_-]*:[a-z][a-z0-9_-]*$`)
+)
+
+// ValidatePermissionCode 校验权限代码
+func ValidatePermissionCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 100, "code", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(code, PermissionCodeRX), "code", "must be in the format resource:action")
+}
+
 // Permissions 存放用户权限
 type Permissions []string
 
@@ -22,27 +39,45 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+// Intersect 方法，返回同时存在于两个权限列表中的权限
+func (p Permissions) Intersect(other Permissions) Permissions {
+	permissions := Permissions{}
+	for i := range p {
+		if other.Include(p[i]) {
+			permissions = append(permissions, p[i])
+		}
+	}
+
+	return permissions
+}
+
 // PermissionModel 结构体
 type PermissionModel struct {
 	DB       *sql.DB
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
+	ctx      context.Context
 }
 
-// GetAllForUser 方法，获取用户的权限
+// GetAllForUser 方法，获取用户的权限（直接授予的权限和通过角色获得的权限）
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	query := `
 		SELECT permissions.code
 		FROM permissions
 			INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-			INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1
+		WHERE users_permissions.user_id = ?
+		UNION
+		SELECT permissions.code
+		FROM permissions
+			INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+			INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		WHERE users_roles.user_id = ?
 		`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "PermissionModel.GetAllForUser")
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	rows, err := m.DB.QueryContext(ctx, query, userID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -71,3 +106,113 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 
 	return permissions, nil
 }
+
+// GetAll 方法，获取permissions表中的所有权限代码
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		SELECT code
+		FROM permissions
+		ORDER BY code
+		`
+
+	ctx, cancel := queryContext(m.ctx, "PermissionModel.GetAll")
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Insert 方法，新增一个权限代码
+func (m PermissionModel) Insert(code string) error {
+	query := `
+		INSERT INTO permissions (code)
+		VALUES (?)
+		`
+
+	ctx, cancel := queryContext(m.ctx, "PermissionModel.Insert")
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, code)
+	if err != nil {
+		switch {
+		case isDuplicateEntry(err):
+			return ErrDuplicatePermission
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddForUser 方法，为用户直接授予权限，重复授予不会报错
+func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	query := `
+		INSERT IGNORE INTO users_permissions (user_id, permission_id)
+		SELECT ?, permissions.id FROM permissions WHERE permissions.code IN (` + placeholders(len(codes)) + `)
+		`
+
+	args := []interface{}{userID}
+	for _, code := range codes {
+		args = append(args, code)
+	}
+
+	ctx, cancel := queryContext(m.ctx, "PermissionModel.AddForUser")
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// RemoveForUser 方法，收回用户直接授予的权限（通过角色获得的权限不受影响）
+func (m PermissionModel) RemoveForUser(userID int64, code string) error {
+	query := `
+		DELETE users_permissions
+		FROM users_permissions
+			INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+		WHERE users_permissions.user_id = ? AND permissions.code = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "PermissionModel.RemoveForUser")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package data
+
+import (
+	"DesignMode/GreenLight/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+var (
+	// ErrDuplicateRole 角色名称重复
+	ErrDuplicateRole = errors.New("duplicate role")
+)
+
+// Role 结构体，一个角色包含一组权限，用户通过角色批量获得权限
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+	Version     int32       `json:"version"`
+}
+
+// ValidateRole 校验角色
+func ValidateRole(v *validator.Validator, role *Role) {
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(len(role.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 bytes long")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+}
+
+// RoleModel 结构体
+type RoleModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	ctx      context.Context
+}
+
+// Insert 在同一个事务中插入角色及其权限
+func (m RoleModel) Insert(role *Role) error {
+	ctx, cancel := queryContext(m.ctx, "RoleModel.Insert")
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO roles (name, description)
+		VALUES (?, ?)
+		`
+
+	result, err := tx.ExecContext(ctx, query, role.Name, role.Description)
+	if err != nil {
+		switch {
+		case isDuplicateEntry(err):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+	role.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	role.Version = 1
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get 获取一个角色及其权限
+func (m RoleModel) Get(id int64) (*Role, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT roles.id, roles.name, roles.description, roles.version,
+			COALESCE(GROUP_CONCAT(permissions.code ORDER BY permissions.code), '')
+		FROM roles
+			LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+			LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+		WHERE roles.id = ?
+		GROUP BY roles.id
+		`
+
+	var (
+		role  Role
+		codes string
+	)
+
+	ctx, cancel := queryContext(m.ctx, "RoleModel.Get")
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&role.ID, &role.Name, &role.Description, &role.Version, &codes)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	role.Permissions = splitCodes(codes)
+
+	return &role, nil
+}
+
+// GetAll 获取所有角色，userID大于0时只返回分配给该用户的角色
+func (m RoleModel) GetAll(userID int64) ([]*Role, error) {
+	query := `
+		SELECT roles.id, roles.name, roles.description, roles.version,
+			COALESCE(GROUP_CONCAT(permissions.code ORDER BY permissions.code), '')
+		FROM roles
+			LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+			LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+		WHERE ? = 0 OR roles.id IN (SELECT role_id FROM users_roles WHERE user_id = ?)
+		GROUP BY roles.id
+		ORDER BY roles.id
+		`
+
+	ctx, cancel := queryContext(m.ctx, "RoleModel.GetAll")
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var (
+			role  Role
+			codes string
+		)
+
+		err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Version, &codes)
+		if err != nil {
+			return nil, err
+		}
+
+		role.Permissions = splitCodes(codes)
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Update 更新角色名称、描述并替换其权限（使用version防止修改冲突）
+func (m RoleModel) Update(role *Role) error {
+	ctx, cancel := queryContext(m.ctx, "RoleModel.Update")
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE roles
+		SET name = ?, description = ?, version = version + 1
+		WHERE id = ? AND version = ?
+		`
+
+	result, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.ID, role.Version)
+	if err != nil {
+		switch {
+		case isDuplicateEntry(err):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	role.Version++
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete 删除一个角色（用户与角色的关联会被级联删除）
+func (m RoleModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM roles
+		WHERE id = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "RoleModel.Delete")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	// 判断删除的行数是否为0
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddForUser 为用户分配一个角色，重复分配不会报错
+func (m RoleModel) AddForUser(userID, roleID int64) error {
+	query := `
+		INSERT IGNORE INTO users_roles (user_id, role_id)
+		VALUES (?, ?)
+		`
+
+	ctx, cancel := queryContext(m.ctx, "RoleModel.AddForUser")
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, roleID)
+	return err
+}
+
+// RemoveForUser 收回用户的一个角色
+func (m RoleModel) RemoveForUser(userID, roleID int64) error {
+	query := `
+		DELETE FROM users_roles
+		WHERE user_id = ? AND role_id = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "RoleModel.RemoveForUser")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// setRolePermissions 在事务中替换角色的全部权限，权限必须来自permissions表
+func setRolePermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions Permissions) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM roles_permissions WHERE role_id = ?`, roleID)
+	if err != nil {
+		return err
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO roles_permissions (role_id, permission_id)
+		SELECT ?, permissions.id FROM permissions WHERE permissions.code IN (` + placeholders(len(permissions)) + `)
+		`
+
+	args := []interface{}{roleID}
+	for _, code := range permissions {
+		args = append(args, code)
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -15,6 +15,9 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	// ScopeTwoFactorPending 密码校验通过但还需要提交两步验证码的短期令牌
+	ScopeTwoFactorPending = "2fa-pending"
 )
 
 // ValidateTokenPlaintext 校验器
@@ -38,6 +41,8 @@ type (
 		DB       *sql.DB
 		InfoLog  *log.Logger
 		ErrorLog *log.Logger
+		ctx      context.Context
+		tx       *sql.Tx // 不为nil时在该事务中执行，见Models.Transaction
 	}
 )
 
@@ -65,11 +70,11 @@ func (m TokenModel) Insert(token *Token) error {
 	// TODO 这里的token.hash存在问题，不能正常添加
 	args := []interface{}{string(token.Hash), token.UserID, token.Expiry, token.Scope}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "TokenModel.Insert")
 	defer cancel()
 
 	// 执行对应sql语句操作
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := m.db().ExecContext(ctx, query, args...)
 	return err
 }
 
@@ -80,11 +85,11 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 		WHERE scope = ? AND user_id = ?
 		`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "TokenModel.DeleteAllForUser")
 	defer cancel()
 
 	// 执行对应sql语句操作
-	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	_, err := m.db().ExecContext(ctx, query, scope, userID)
 	return err
 }
 
@@ -116,3 +121,11 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 
 	return token, nil
 }
+
+// db 在事务中时返回事务，否则返回连接池
+func (m TokenModel) db() dbtx {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"DesignMode/GreenLight/internal/validator"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// 恢复码数量
+const recoveryCodeCount = 10
+
+// TwoFactor 结构体，存放用户的TOTP密钥和启用状态
+type TwoFactor struct {
+	UserID      int64
+	Secret      string
+	Enabled     bool
+	LastCounter uint64 // 最后一次接受的验证码的时间步数，不大于它的验证码不能再次使用
+}
+
+// TwoFactorModel 结构体
+type TwoFactorModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	ctx      context.Context
+}
+
+// ValidateTOTPCode 校验TOTP验证码格式
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 6, "code", "must be 6 digits long")
+}
+
+// Get 获取用户的TOTP设置，未登记时返回ErrRecordNotFound
+func (m TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+		SELECT user_id, secret, enabled, last_counter
+		FROM users_totp
+		WHERE user_id = ?
+		`
+
+	var tf TwoFactor
+
+	ctx, cancel := queryContext(m.ctx, "TwoFactorModel.Get")
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &tf.LastCounter)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tf, nil
+}
+
+// SetPending 保存一个尚未确认的TOTP密钥（重新登记会覆盖之前未确认的密钥）
+func (m TwoFactorModel) SetPending(userID int64, secret string) error {
+	query := `
+		INSERT INTO users_totp (user_id, secret, enabled, last_counter)
+		VALUES (?, ?, false, 0)
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = false, last_counter = 0
+		`
+
+	ctx, cancel := queryContext(m.ctx, "TwoFactorModel.SetPending")
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, secret)
+	return err
+}
+
+// UseCounter 记录一次接受的验证码的时间步数。counter不大于已记录的时间步数时返回false（验证码已被使用），
+// 条件更新保证并发的相同验证码只有一个被接受
+func (m TwoFactorModel) UseCounter(userID int64, counter uint64) (bool, error) {
+	query := `
+		UPDATE users_totp
+		SET last_counter = ?
+		WHERE user_id = ? AND last_counter < ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "TwoFactorModel.UseCounter")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, counter, userID, counter)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Enable 启用TOTP，并生成新的恢复码（返回明文，只展示一次）
+func (m TwoFactorModel) Enable(userID int64) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := queryContext(m.ctx, "TwoFactorModel.Enable")
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users_totp SET enabled = true WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range hashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`, userID, hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable 关闭TOTP，并删除所有恢复码
+func (m TwoFactorModel) Disable(userID int64) error {
+	ctx, cancel := queryContext(m.ctx, "TwoFactorModel.Disable")
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_totp WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode 使用一个恢复码，每个恢复码只能使用一次
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+
+	query := `
+		UPDATE recovery_codes
+		SET used_at = ?
+		WHERE user_id = ? AND hash = ? AND used_at IS NULL
+		`
+
+	ctx, cancel := queryContext(m.ctx, "TwoFactorModel.UseRecoveryCode")
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now(), userID, hash[:])
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// generateRecoveryCodes 生成恢复码明文及其sha256哈希值，格式为 xxxxx-xxxxx
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		randomBytes := make([]byte, 10)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+		code := encoded[:5] + "-" + encoded[5:10]
+
+		hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+		codes = append(codes, code)
+		hashes = append(hashes, hash[:])
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode 忽略大小写、空格和连字符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -3,9 +3,12 @@ package data
 import (
 	"DesignMode/GreenLight/internal/validator"
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base32"
 	"errors"
+	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"time"
@@ -21,6 +24,8 @@ type UserModel struct {
 	DB       *sql.DB
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
+	ctx      context.Context
+	tx       *sql.Tx // 不为nil时在该事务中执行，见Models.Transaction
 }
 
 // AnonymousUser 匿名用户
@@ -39,7 +44,15 @@ type User struct {
 	Email     string   `json:"email"`
 	Password  password `json:"-"`
 	Activated bool     `json:"activated"`
-	Version   int      `json:"-"`
+	// 管理员停用账户的时间，未激活（等待激活）的账户为nil
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	Language      string     `json:"language"` // 邮件使用的语言，如 en、zh-CN
+	Version       int        `json:"-"`
+}
+
+// PendingActivation 判断用户是否从未激活（注册后等待激活），被管理员停用的账户不属于此类
+func (u *User) PendingActivation() bool {
+	return !u.Activated && u.DeactivatedAt == nil
 }
 
 // password 结构体
@@ -60,6 +73,19 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// SetRandom 设置一个随机密码，使原密码失效（强制重置密码时使用）
+func (p *password) SetRandom() error {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	err = p.Set(base32.StdEncoding.EncodeToString(randomBytes))
+	// 随机密码不需要再做明文校验
+	p.plaintext = nil
+	return err
+}
+
 // Matches 判断密码是否匹配
 func (p *password) Matches(plaintextPassword string) (bool, error) {
 	// 使用bcrypt对密码进行比较
@@ -78,50 +104,95 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 // Insert 插入用户
 func (m UserModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (created_at, name, email, password_hash, activated)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO users (created_at, name, email, password_hash, activated, language)
+		VALUES (?, ?, ?, ?, ?, ?)
 		`
 
-	args := []interface{}{time.Now().Unix(), user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []interface{}{time.Now().Unix(), user.Name, user.Email, user.Password.hash, user.Activated, user.Language}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "UserModel.Insert")
 	defer cancel()
 
-	// 执行插入
-	err := m.DB.QueryRowContext(ctx, query, args...).Err()
+	// 执行插入（MySQL不支持RETURNING，通过LastInsertId获取新用户的ID）
+	result, err := m.db().ExecContext(ctx, query, args...)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`, isDuplicateEntry(err):
 			return ErrDuplicateEmail
 		default:
 			return err
 		}
 	}
 
-	return nil
+	user.ID, err = result.LastInsertId()
+	return err
+}
+
+// Get 通过ID获取用户
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, deactivated_at, language, version
+		FROM users
+		WHERE id = ?
+		`
+	// 声明user
+	var user User
+
+	ctx, cancel := queryContext(m.ctx, "UserModel.Get")
+	defer cancel()
+
+	// 执行查询
+	err := m.db().QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DeactivatedAt,
+		&user.Language,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
 }
 
 // GetByEmail 通过邮箱获取用户
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, deactivated_at, language, version
 		FROM users
 		WHERE email = ?
 		`
 	// 声明user
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "UserModel.GetByEmail")
 	defer cancel()
 
 	// 执行查询
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+	err := m.db().QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DeactivatedAt,
+		&user.Language,
 		&user.Version,
 	)
 
@@ -141,7 +212,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 		UPDATE users
-		SET name = ?, email = ?, password_hash = ?, activated = ?, version = version + 1
+		SET name = ?, email = ?, password_hash = ?, activated = ?, deactivated_at = ?, language = ?, version = version + 1
 		WHERE id = ? AND version = ?
 		`
 
@@ -150,24 +221,127 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.DeactivatedAt,
+		user.Language,
 		user.ID,
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "UserModel.Update")
 	defer cancel()
-	// 执行更新
-	err := m.DB.QueryRowContext(ctx, query, args...).Err()
+	// 执行更新（UPDATE语句不会返回sql.ErrNoRows，需要通过影响行数判断版本冲突）
+	result, err := m.db().ExecContext(ctx, query, args...)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`, isDuplicateEntry(err):
 			return ErrDuplicateEmail
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
 		default:
 			return err
 		}
 	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	user.Version++
+
+	return nil
+}
+
+// GetAll 分页获取用户列表，name和email为模糊匹配，activated为空时不过滤激活状态
+func (m UserModel) GetAll(name, email string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, activated, deactivated_at, language, version
+		FROM users
+		WHERE (name LIKE ? OR ? = '')
+			AND (email LIKE ? OR ? = '')
+			AND (activated = ? OR ? IS NULL)
+		ORDER BY %s %s, id ASC
+		LIMIT ? OFFSET ?
+		`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{
+		"%" + name + "%", name,
+		"%" + email + "%", email,
+		activated, activated,
+		filters.limit(), filters.offset(),
+	}
+
+	ctx, cancel := queryContext(m.ctx, "UserModel.GetAll")
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.DeactivatedAt,
+			&user.Language,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// Delete 删除用户（令牌、权限、角色等关联记录由外键级联删除）
+func (m UserModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM users
+		WHERE id = ?
+		`
+
+	ctx, cancel := queryContext(m.ctx, "UserModel.Delete")
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	// 判断删除的行数是否为0
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
 
 	return nil
 }
@@ -180,7 +354,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	query := `
 		SELECT 
 			users.id, users.created_at, users.name, users.email, 
-			users.password_hash, users.activated, users.version
+			users.password_hash, users.activated, users.deactivated_at, users.language, users.version
 		FROM       users
         INNER JOIN tokens
 			ON users.id = tokens.user_id
@@ -194,17 +368,19 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// 声明user
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "UserModel.GetForToken")
 	defer cancel()
 
 	// 执行查询
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(
 		&user.ID,
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DeactivatedAt,
+		&user.Language,
 		&user.Version,
 	)
 
@@ -238,6 +414,8 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(user.Language != "", "language", "must be provided")
+	v.Check(len(user.Language) <= 16, "language", "must not be more than 16 bytes long")
 	// 调用 ValidateEmail() helper。
 	ValidateEmail(v, user.Email)
 	// 调用 ValidatePasswordPlaintext() helper。
@@ -249,3 +427,11 @@ func ValidateUser(v *validator.Validator, user *User) {
 		panic("missing password hash for user")
 	}
 }
+
+// db 在事务中时返回事务，否则返回连接池
+func (m UserModel) db() dbtx {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
@@ -2,10 +2,13 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,19 +37,46 @@ func (l Level) String() string {
 	}
 }
 
+// ParseLevel 解析日志等级（info|error|fatal|off，不区分大小写）
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	case "off":
+		return LevelOff, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
 // Logger 日志实例结构体
 type Logger struct {
 	out      io.Writer
-	minLevel Level
+	minLevel atomic.Int32 // 运行时可以通过SetLevel修改
 	mu       sync.Mutex
 }
 
 // 创建 一个 Logger 实例
 func NewLogger(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		out:      out,
-		minLevel: minLevel,
+	l := &Logger{
+		out: out,
 	}
+	l.SetLevel(minLevel)
+	return l
+}
+
+// SetLevel 修改最小日志等级，可以在运行时并发调用
+func (l *Logger) SetLevel(level Level) {
+	l.minLevel.Store(int32(level))
+}
+
+// Level 返回当前的最小日志等级
+func (l *Logger) Level() Level {
+	return Level(l.minLevel.Load())
 }
 
 // PrintInfo 是一个 helper 方法，它写一个 Info 级别的日志条目
@@ -69,7 +99,7 @@ func (l *Logger) PrintFatal(err error, properties map[string]string) {
 // print 方法 打印各种错误等级的日志
 func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
 	// 如果日志等级小于最小等级，则直接返回
-	if level < l.minLevel {
+	if level < l.Level() {
 		return 0, nil
 	}
 
@@ -0,0 +1,127 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// JWK RFC 7517 中的JSON Web Key，只包含公钥相关的字段
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Use       string `json:"use,omitempty"`
+	// RSA公钥
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP（Ed25519）公钥
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set，身份提供方通过jwks_uri发布
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseJWKS 解析JWKS文档，返回只能用于校验的密钥集合。
+// 用于加密的密钥和不支持的密钥类型会被忽略。
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwt: invalid JWKS: %w", err)
+	}
+
+	ks := NewKeySet(nil)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.Key()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			ks.keys[key.ID] = key
+		}
+	}
+
+	return ks, nil
+}
+
+// Key 将JWK转换为只能用于校验的密钥，不支持的密钥类型返回nil
+func (j JWK) Key() (*Key, error) {
+	switch {
+	case j.KeyType == "RSA" && (j.Algorithm == "" || j.Algorithm == AlgRS256):
+		n, err := encoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid modulus for key %q", j.KeyID)
+		}
+		e, err := encoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwt: invalid exponent for key %q", j.KeyID)
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return NewRSAPublicKey(j.KeyID, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent})
+	case j.KeyType == "OKP" && j.Curve == "Ed25519":
+		x, err := encoding.DecodeString(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid public key %q", j.KeyID)
+		}
+		return NewEd25519PublicKey(j.KeyID, x)
+	default:
+		return nil, nil
+	}
+}
+
+// PublicJWK 返回密钥的公钥部分，用于发布JWKS（HS256密钥没有公钥）
+func (k *Key) PublicJWK() (JWK, error) {
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.ID,
+			Algorithm: AlgRS256,
+			Use:       "sig",
+			N:         encoding.EncodeToString(public.N.Bytes()),
+			E:         encoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.ID,
+			Algorithm: AlgEdDSA,
+			Use:       "sig",
+			Curve:     "Ed25519",
+			X:         encoding.EncodeToString(public),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("jwt: key %q has no public key", k.ID)
+	}
+}
+
+// PublicJWKS 返回密钥集合中所有公钥组成的JWKS，按kid排序。
+// HS256密钥没有公钥，不会被发布；只有HS256密钥时返回空的JWKS。
+func (ks *KeySet) PublicJWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if key.public == nil {
+			continue
+		}
+		jwk, err := key.PublicJWK()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
@@ -0,0 +1,295 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TODO 无状态JWT签发与校验（只依赖标准库，支持HS256、Ed25519和RS256，并通过kid进行密钥轮换）
+
+// 支持的签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+// RSA密钥的最小长度（位）
+const minRSAKeyBits = 2048
+
+// 允许的时钟偏差，避免各个服务之间的时间误差导致令牌被误判为过期
+const allowedClockSkew = 30 * time.Second
+
+var (
+	// ErrInvalidToken 令牌格式或签名错误
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	// ErrUnknownKey 令牌中的kid不在密钥集合中
+	ErrUnknownKey = errors.New("jwt: unknown key id")
+	// ErrExpired 令牌已过期
+	ErrExpired = errors.New("jwt: token has expired")
+	// ErrNotYetValid 令牌还未生效
+	ErrNotYetValid = errors.New("jwt: token is not valid yet")
+	// ErrInvalidIssuer 签发者不匹配
+	ErrInvalidIssuer = errors.New("jwt: invalid issuer")
+	// ErrInvalidAudience 受众不匹配
+	ErrInvalidAudience = errors.New("jwt: invalid audience")
+)
+
+// 统一使用不带填充的URL安全base64编码
+var encoding = base64.RawURLEncoding
+
+// header JWT头部
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Audience 受众，JSON中既可以是字符串也可以是字符串数组
+type Audience []string
+
+// UnmarshalJSON 同时兼容字符串和数组两种格式
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// Contains 判断受众中是否包含指定值
+func (a Audience) Contains(value string) bool {
+	for i := range a {
+		if a[i] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisteredClaims RFC 7519 中定义的标准声明，可以嵌入到自定义的声明结构体中
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Validate 校验过期时间、生效时间、签发者和受众
+func (c RegisteredClaims) Validate(now time.Time, issuer, audience string) error {
+	if c.ExpiresAt == 0 || now.Add(-allowedClockSkew).Unix() >= c.ExpiresAt {
+		return ErrExpired
+	}
+	if c.NotBefore != 0 && now.Add(allowedClockSkew).Unix() < c.NotBefore {
+		return ErrNotYetValid
+	}
+	if issuer != "" && c.Issuer != issuer {
+		return ErrInvalidIssuer
+	}
+	if audience != "" && !c.Audience.Contains(audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// Key 签名密钥，一个kid对应一个算法和密钥材料
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// NewHMACKey 创建一个HS256密钥，密钥长度至少为32字节
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("jwt: HS256 key %q must be at least 32 bytes", id)
+	}
+	return &Key{ID: id, Algorithm: AlgHS256, secret: secret}, nil
+}
+
+// NewEd25519Key 使用32字节的种子创建一个可签名的Ed25519密钥
+func NewEd25519Key(id string, seed []byte) (*Key, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("jwt: Ed25519 key %q must be a %d byte seed", id, ed25519.SeedSize)
+	}
+	private := ed25519.NewKeyFromSeed(seed)
+	return &Key{ID: id, Algorithm: AlgEdDSA, private: private, public: private.Public()}, nil
+}
+
+// NewEd25519PublicKey 创建一个只能用于校验的Ed25519公钥（边缘服务离线校验时使用）
+func NewEd25519PublicKey(id string, public []byte) (*Key, error) {
+	if len(public) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("jwt: Ed25519 public key %q must be %d bytes", id, ed25519.PublicKeySize)
+	}
+	return &Key{ID: id, Algorithm: AlgEdDSA, public: ed25519.PublicKey(public)}, nil
+}
+
+// NewRSAKey 创建一个可签名的RS256密钥
+func NewRSAKey(id string, private *rsa.PrivateKey) (*Key, error) {
+	if private.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("jwt: RS256 key %q must be at least %d bits", id, minRSAKeyBits)
+	}
+	return &Key{ID: id, Algorithm: AlgRS256, private: private, public: &private.PublicKey}, nil
+}
+
+// NewRSAPublicKey 创建一个只能用于校验的RS256公钥（校验第三方身份提供方签发的令牌时使用）
+func NewRSAPublicKey(id string, public *rsa.PublicKey) (*Key, error) {
+	if public.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("jwt: RS256 key %q must be at least %d bits", id, minRSAKeyBits)
+	}
+	return &Key{ID: id, Algorithm: AlgRS256, public: public}, nil
+}
+
+// sign 对签名输入进行签名
+func (k *Key) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case AlgEdDSA:
+		if k.private == nil {
+			return nil, fmt.Errorf("jwt: key %q cannot be used for signing", k.ID)
+		}
+		return k.private.Sign(nil, input, crypto.Hash(0))
+	case AlgRS256:
+		if k.private == nil {
+			return nil, fmt.Errorf("jwt: key %q cannot be used for signing", k.ID)
+		}
+		digest := sha256.Sum256(input)
+		return k.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("jwt: unsupported algorithm %q", k.Algorithm)
+	}
+}
+
+// verify 校验签名是否正确
+func (k *Key) verify(input, signature []byte) bool {
+	switch k.Algorithm {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case AlgEdDSA:
+		public, ok := k.public.(ed25519.PublicKey)
+		return ok && ed25519.Verify(public, input, signature)
+	case AlgRS256:
+		public, ok := k.public.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
+
+// KeySet 密钥集合，signing用于签发，其余的密钥只用于校验（用于密钥轮换）
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet 创建一个密钥集合，signing为当前签发令牌使用的密钥，可以为nil（只校验）
+func NewKeySet(signing *Key, others ...*Key) *KeySet {
+	ks := &KeySet{signing: signing, keys: make(map[string]*Key)}
+	if signing != nil {
+		ks.keys[signing.ID] = signing
+	}
+	for _, k := range others {
+		ks.keys[k.ID] = k
+	}
+	return ks
+}
+
+// Sign 使用签发密钥对claims进行签名，并返回紧凑格式的JWT
+func (ks *KeySet) Sign(claims interface{}) (string, error) {
+	if ks.signing == nil {
+		return "", errors.New("jwt: key set has no signing key")
+	}
+
+	h, err := json.Marshal(header{Algorithm: ks.signing.Algorithm, Type: "JWT", KeyID: ks.signing.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+	signature, err := ks.signing.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+
+	return input + "." + encoding.EncodeToString(signature), nil
+}
+
+// Parse 校验令牌签名，并将载荷解码到claims中。
+// 注意：Parse只校验签名，过期时间、签发者等由调用方通过RegisteredClaims.Validate()校验。
+func (ks *KeySet) Parse(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return ErrInvalidToken
+	}
+
+	// 根据kid查找密钥，并要求头部的算法与密钥的算法一致，防止算法混淆攻击
+	key, ok := ks.keys[h.KeyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+	if h.Algorithm != key.Algorithm {
+		return ErrInvalidToken
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalidToken
+	}
+
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
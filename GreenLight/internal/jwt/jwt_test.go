@@ -0,0 +1,199 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClaims struct {
+	RegisteredClaims
+	Permissions []string `json:"permissions"`
+}
+
+func newTestClaims(now time.Time) testClaims {
+	return testClaims{
+		RegisteredClaims: RegisteredClaims{
+			Issuer:    "greenlight",
+			Subject:   "42",
+			Audience:  Audience{"greenlight-api"},
+			ExpiresAt: now.Add(time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Permissions: []string{"movies:read"},
+	}
+}
+
+// TestSignAndParse 测试HS256和Ed25519的签发与校验
+func TestSignAndParse(t *testing.T) {
+	hmacKey, err := NewHMACKey("h1", bytes.Repeat([]byte("s"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, err := NewEd25519Key("e1", bytes.Repeat([]byte("e"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []*Key{hmacKey, edKey} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			ks := NewKeySet(key)
+			now := time.Now()
+
+			token, err := ks.Sign(newTestClaims(now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var claims testClaims
+			if err := ks.Parse(token, &claims); err != nil {
+				t.Fatal(err)
+			}
+			if err := claims.Validate(now, "greenlight", "greenlight-api"); err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "42" || len(claims.Permissions) != 1 || claims.Permissions[0] != "movies:read" {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+
+			// 篡改载荷后签名校验必须失败
+			parts := strings.Split(token, ".")
+			forged := parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":"1"}`)) + "." + parts[2]
+			if err := ks.Parse(forged, &claims); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected ErrInvalidToken for forged token, got %v", err)
+			}
+		})
+	}
+}
+
+// TestKeyRotation 测试轮换后旧密钥签发的令牌仍然可以校验，未知kid被拒绝
+func TestKeyRotation(t *testing.T) {
+	oldKey, _ := NewHMACKey("old", bytes.Repeat([]byte("o"), 32))
+	newKey, _ := NewHMACKey("new", bytes.Repeat([]byte("n"), 32))
+
+	token, err := NewKeySet(oldKey).Sign(newTestClaims(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims testClaims
+	if err := NewKeySet(newKey, oldKey).Parse(token, &claims); err != nil {
+		t.Errorf("expected rotated key set to accept old token, got %v", err)
+	}
+	if err := NewKeySet(newKey).Parse(token, &claims); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+// TestVerifyOnlyKey 测试只持有公钥的服务可以校验Ed25519令牌
+func TestVerifyOnlyKey(t *testing.T) {
+	signing, _ := NewEd25519Key("e1", bytes.Repeat([]byte("e"), 32))
+	token, err := NewKeySet(signing).Sign(newTestClaims(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := NewEd25519PublicKey("e1", signing.public.(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewKeySet(nil, public)
+
+	var claims testClaims
+	if err := verifier.Parse(token, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Sign(claims); err == nil {
+		t.Error("expected verify-only key set to refuse signing")
+	}
+}
+
+// TestValidate 测试过期时间、签发者和受众的校验
+func TestValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		modify   func(c *RegisteredClaims)
+		expected error
+	}{
+		{"valid", func(c *RegisteredClaims) {}, nil},
+		{"expired", func(c *RegisteredClaims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }, ErrExpired},
+		{"not yet valid", func(c *RegisteredClaims) { c.NotBefore = now.Add(time.Minute).Unix() }, ErrNotYetValid},
+		{"wrong issuer", func(c *RegisteredClaims) { c.Issuer = "someone-else" }, ErrInvalidIssuer},
+		{"wrong audience", func(c *RegisteredClaims) { c.Audience = Audience{"other"} }, ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := newTestClaims(now).RegisteredClaims
+			tt.modify(&claims)
+			if err := claims.Validate(now, "greenlight", "greenlight-api"); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestJWKS 测试RS256令牌可以通过发布的JWKS校验
+func TestJWKS(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing, err := NewRSAKey("r1", private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := NewKeySet(signing).Sign(newTestClaims(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := signing.PublicJWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 加密用途的密钥不能用于校验签名
+	enc := jwk
+	enc.KeyID = "enc"
+	enc.Use = "enc"
+	doc, err := json.Marshal(JWKS{Keys: []JWK{jwk, enc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := ParseJWKS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := verifier.keys["enc"]; ok {
+		t.Error("expected encryption key to be ignored")
+	}
+
+	var claims testClaims
+	if err := verifier.Parse(token, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" {
+		t.Errorf("want subject 42; got %q", claims.Subject)
+	}
+
+	// 使用公钥作为HMAC密钥伪造的令牌必须被拒绝（算法混淆攻击）
+	parts := strings.Split(token, ".")
+	forgedHeader := encoding.EncodeToString([]byte(`{"alg":"HS256","kid":"r1"}`))
+	mac := hmac.New(sha256.New, []byte(jwk.N))
+	mac.Write([]byte(forgedHeader + "." + parts[1]))
+	forged := forgedHeader + "." + parts[1] + "." + encoding.EncodeToString(mac.Sum(nil))
+	if err := verifier.Parse(forged, &claims); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for algorithm confusion, got %v", err)
+	}
+}
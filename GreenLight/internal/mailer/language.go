@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TODO 该文件存储邮件模板的语言：templates下每个目录是一种语言，缺少翻译的模板使用DefaultLanguage
+
+// DefaultLanguage 默认语言，所有模板都必须有该语言的版本
+const DefaultLanguage = "en"
+
+// Languages 返回有邮件模板的语言（templates下的目录名），按名称排序
+func Languages() []string {
+	entries, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return []string{DefaultLanguage}
+	}
+
+	var languages []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			languages = append(languages, entry.Name())
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// ParseLanguage 将语言标签（如 zh-cn、zh-Hans-CN、en-US）匹配到支持的语言，
+// 先按完整标签（不区分大小写）匹配，再按主语言（zh、en）匹配
+func ParseLanguage(tag string) (string, bool) {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return "", false
+	}
+
+	languages := Languages()
+	for _, language := range languages {
+		if strings.EqualFold(language, tag) {
+			return language, true
+		}
+	}
+
+	primary, _, _ := strings.Cut(tag, "-")
+	for _, language := range languages {
+		base, _, _ := strings.Cut(language, "-")
+		if strings.EqualFold(base, primary) {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// MatchLanguage 根据Accept-Language请求头（如 zh-CN,zh;q=0.9,en;q=0.8）选择权重最高的支持语言，
+// 没有匹配时返回DefaultLanguage
+func MatchLanguage(acceptLanguage string) string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{tag: tag, q: q})
+	}
+
+	// 权重相同时保持请求头中的顺序
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	for _, c := range candidates {
+		if language, ok := ParseLanguage(c.tag); ok {
+			return language
+		}
+	}
+	return DefaultLanguage
+}
+
+// MissingTranslations 返回每种语言缺少翻译的模板（相对于DefaultLanguage），没有缺少时返回空map
+func MissingTranslations() map[string][]string {
+	missing := map[string][]string{}
+
+	base, err := fs.Glob(templateFS, path.Join("templates", DefaultLanguage, "*.tmpl"))
+	if err != nil {
+		return missing
+	}
+
+	for _, language := range Languages() {
+		if language == DefaultLanguage {
+			continue
+		}
+		for _, file := range base {
+			name := path.Base(file)
+			if _, err := fs.Stat(templateFS, path.Join("templates", language, name)); err != nil {
+				missing[language] = append(missing[language], name)
+			}
+		}
+	}
+	return missing
+}
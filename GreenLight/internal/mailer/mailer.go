@@ -3,9 +3,14 @@ package mailer
 import (
 	"bytes"
 	"embed"
-	"github.com/go-mail/mail/v2"
-	"html/template"
-	"time"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 // 嵌入静态文件
@@ -13,30 +18,106 @@ import (
 //go:embed "templates"
 var templateFS embed.FS
 
+// 嵌入邮件中引用的图片等资源。不能放在templates下，templates下的每个目录都是一种语言
+//
+//go:embed "assets"
+var assetFS embed.FS
+
+// cidPattern 匹配HTML正文中对内嵌资源的引用，如 <img src="cid:logo.png">
+var cidPattern = regexp.MustCompile(`cid:([A-Za-z0-9._-]+)`)
+
+// reservedHeaders 由Mail的字段生成的邮件头，不能通过Headers设置
+var reservedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Subject": true,
+	"Date": true, "Message-Id": true, "Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+}
+
+// Mail 一封待发送的邮件：收件人、使用的模板和数据，以及附件、内嵌图片和自定义邮件头
+type Mail struct {
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     string
+	Template    string
+	Language    string // 为空时使用DefaultLanguage
+	Data        interface{}
+	Headers     map[string]string
+	Attachments []Attachment
+	Inline      []Attachment // 模板中引用的assets下的图片会自动内嵌，不需要在这里指定
+}
+
+// SetListUnsubscribe 设置List-Unsubscribe头，url可以是mailto:或https:地址。
+// 使用https地址时同时设置List-Unsubscribe-Post，支持邮件客户端的一键退订（RFC 8058）
+func (ml *Mail) SetListUnsubscribe(urls ...string) {
+	if ml.Headers == nil {
+		ml.Headers = map[string]string{}
+	}
+
+	values := make([]string, 0, len(urls))
+	for _, url := range urls {
+		values = append(values, "<"+url+">")
+		if strings.HasPrefix(url, "https://") {
+			ml.Headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+		}
+	}
+	ml.Headers["List-Unsubscribe"] = strings.Join(values, ", ")
+}
+
+// validate 检查收件人地址和自定义邮件头，避免通过换行符注入邮件头
+func (ml *Mail) validate() error {
+	if len(ml.To)+len(ml.Cc)+len(ml.Bcc) == 0 {
+		return errors.New("email has no recipients")
+	}
+
+	addresses := append(append(append([]string{}, ml.To...), ml.Cc...), ml.Bcc...)
+	if ml.ReplyTo != "" {
+		addresses = append(addresses, ml.ReplyTo)
+	}
+	for _, address := range addresses {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("invalid email address %q: %w", address, err)
+		}
+	}
+
+	for name, value := range ml.Headers {
+		if name == "" || strings.ContainsAny(name, ": \r\n") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid email header %q", name)
+		}
+		if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("email header %q cannot be set directly", name)
+		}
+	}
+
+	for _, a := range append(append([]Attachment{}, ml.Attachments...), ml.Inline...) {
+		if a.Filename == "" || strings.ContainsAny(a.Filename, "\"\r\n/") {
+			return fmt.Errorf("invalid attachment filename %q", a.Filename)
+		}
+	}
+	return nil
+}
+
 // 声明Mailer结构体
 type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+	transport Transport
+	sender    string
+	templates templateCache
 }
 
-// New 创建并初始化一个新的Mailer实例。
-// 这个函数需要主机地址、端口号、用户名、密码和发件人地址作为参数。
-// 主机地址(host)是邮件服务器的地址。
-// 端口号(port)是邮件服务器使用的端口。
-// 用户名(username)和密码(password)用于邮件服务器的身份验证。
+// New 创建并初始化一个新的Mailer实例，并一次性解析templates下所有语言的模板。
+// 发送方式(transport)决定邮件如何投递：SMTP、写入outbox目录、只记录日志或保存在内存中。
 // 发件人地址(sender)是邮件的发送方地址。
-// 函数返回一个新的Mailer实例。
-func New(host string, port int, username, password, sender string) Mailer {
-	// 初始化Dialer
-	dialer := mail.NewDialer(host, port, username, password)
-	// 设置Dialer的超时时间为5秒，以防止连接耗时过长
-	dialer.Timeout = 5 * time.Second
-
-	// 返回Mailer实例，包含初始化的Dialer和发件人地址
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
+// 模板无法解析或缺少subject、plainBody、htmlBody定义时返回错误。
+func New(transport Transport, sender string) (Mailer, error) {
+	templates, err := parseTemplates(templateFS)
+	if err != nil {
+		return Mailer{}, err
 	}
+
+	return Mailer{
+		transport: transport,
+		sender:    sender,
+		templates: templates,
+	}, nil
 }
 
 // Send 方法用于发送邮件。
@@ -51,52 +132,122 @@ func New(host string, port int, username, password, sender string) Mailer {
 //
 //	如果邮件发送成功，则返回nil；否则返回错误。
 func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
-	// 创建一个mail.NewMessage()实例
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	return m.SendLocalized(recipient, DefaultLanguage, templateFile, data)
+}
+
+// SendLocalized 使用指定语言的模板（templates/<language>/<templateFile>）发送邮件，
+// 该语言没有翻译时使用DefaultLanguage的模板
+func (m Mailer) SendLocalized(recipient, language, templateFile string, data interface{}) error {
+	return m.SendMail(&Mail{
+		To:       []string{recipient},
+		Template: templateFile,
+		Language: language,
+		Data:     data,
+	})
+}
+
+// SendMail 渲染并发送邮件，支持多个收件人、抄送、密送、回复地址、附件、内嵌图片和自定义邮件头
+func (m Mailer) SendMail(ml *Mail) error {
+	err := ml.validate()
 	if err != nil {
 		return err
 	}
 
+	language := ml.Language
+	if language == "" {
+		language = DefaultLanguage
+	}
+
+	msg, err := m.Render(language, ml.Template, ml.Data)
+	if err != nil {
+		return err
+	}
+
+	msg.To = ml.To
+	msg.Cc = ml.Cc
+	msg.Bcc = ml.Bcc
+	msg.ReplyTo = ml.ReplyTo
+	msg.Headers = ml.Headers
+	msg.Attachments = ml.Attachments
+	msg.Inline = append(msg.Inline, ml.Inline...)
+	return m.transport.Send(msg)
+}
+
+// Render 使用缓存的模板渲染邮件的主题和正文（不包含收件人），用于发送和预览。
+// HTML正文中通过 cid:<文件名> 引用的assets下的资源会作为内嵌图片加入邮件
+func (m Mailer) Render(language, templateFile string, data interface{}) (*Message, error) {
+	tmpl, err := m.templates.lookup(language, templateFile)
+	if err != nil {
+		return nil, err
+	}
+
 	// 生成邮件主题
 	subject := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 生成纯文本邮件正文
 	plainBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 生成HTML邮件正文
 	htmlBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 创建邮件消息并设置相关头信息
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	inline, err := inlineAssets(htmlBody.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		From:      m.sender,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+		Inline:    inline,
+		Template:  templateFile,
+		Language:  language,
+	}, nil
+}
 
-	// 尝试发送邮件，最多重试3次
-	for i := 1; i <= 3; i++ {
-		err = m.dialer.DialAndSend(msg)
-		if nil == err {
-			return nil
+// inlineAssets 返回HTML正文中通过cid引用的assets下的资源，每个资源只内嵌一次。
+// 不在assets下的引用跳过，由调用方通过Mail.Inline提供
+func inlineAssets(html string) ([]Attachment, error) {
+	var inline []Attachment
+	seen := map[string]bool{}
+	for _, match := range cidPattern.FindAllStringSubmatch(html, -1) {
+		name := match[1]
+		if seen[name] {
+			continue
 		}
+		seen[name] = true
 
-		// 如果发送失败，等待500毫秒后重试
-		time.Sleep(500 * time.Millisecond)
+		data, err := fs.ReadFile(assetFS, "assets/"+name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		inline = append(inline, Attachment{Filename: name, Data: data})
 	}
+	return inline, nil
+}
 
-	// 如果经过重试后仍然发送失败，则返回错误
-	return err
+// Templates 返回所有模板文件的名称（DefaultLanguage下的模板），按名称排序
+func (m Mailer) Templates() []string {
+	var names []string
+	for name := range m.templates[DefaultLanguage] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
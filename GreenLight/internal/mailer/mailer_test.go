@@ -0,0 +1,311 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// newTestMailer 创建使用内置模板的Mailer
+func newTestMailer(t *testing.T, transport Transport, sender string) Mailer {
+	t.Helper()
+
+	m, err := New(transport, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestFileTransport 测试file发送方式将渲染后的邮件写入outbox目录，每封邮件一个可以解析的.eml文件
+func TestFileTransport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	transport, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestMailer(t, transport, "Greenlight <no-reply@greenlight.test>")
+
+	data := map[string]interface{}{"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "userID": 7}
+	for i := 0; i < 2; i++ {
+		if err := m.Send("alice@example.com", "user_welcome.tmpl", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Ext(files[0]) != ".eml" {
+		t.Fatalf("want 2 .eml files without temporary files; got %v", files)
+	}
+
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("To") != "alice@example.com" || !strings.Contains(msg.Header.Get("Subject"), "Welcome to Greenlight!") {
+		t.Errorf("unexpected headers %v", msg.Header)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if !strings.Contains(string(body), "ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		t.Errorf("want activation token in the message body; got %s", body)
+	}
+}
+
+// TestMemoryTransport 测试内存发送方式记录渲染后的邮件，模板不存在时返回错误且不发送
+func TestMemoryTransport(t *testing.T) {
+	transport := NewMemory()
+	m := newTestMailer(t, transport, "no-reply@greenlight.test")
+
+	err := m.Send("bob@example.com", "token_password_reset.tmpl", map[string]interface{}{"passwordResetToken": "RESET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send("bob@example.com", "missing.tmpl", nil); err == nil {
+		t.Error("want error for a missing template")
+	}
+
+	messages := transport.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("want 1 message; got %d", len(messages))
+	}
+	msg := messages[0]
+	if len(msg.To) != 1 || msg.To[0] != "bob@example.com" || msg.From != "no-reply@greenlight.test" || msg.Template != "token_password_reset.tmpl" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if !strings.Contains(msg.PlainBody, "RESET") || !strings.Contains(msg.HTMLBody, "RESET") {
+		t.Errorf("want reset token in both bodies; got %q / %q", msg.PlainBody, msg.HTMLBody)
+	}
+}
+
+// TestSendMail 测试多个收件人、抄送、密送、回复地址、自定义邮件头、附件和模板中引用的内嵌logo
+func TestSendMail(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestMailer(t, transport, "no-reply@greenlight.test")
+
+	ml := &Mail{
+		To:          []string{"alice@example.com", "bob@example.com"},
+		Cc:          []string{"carol@example.com"},
+		Bcc:         []string{"audit@example.com"},
+		ReplyTo:     "support@greenlight.test",
+		Template:    "user_welcome.tmpl",
+		Data:        map[string]interface{}{"activationToken": "TOKEN", "userID": 7},
+		Headers:     map[string]string{"X-Campaign": "welcome"},
+		Attachments: []Attachment{{Filename: "terms.txt", ContentType: "text/plain", Data: []byte("terms")}},
+	}
+	ml.SetListUnsubscribe("mailto:unsubscribe@greenlight.test", "https://greenlight.test/unsubscribe?u=7")
+	if err := m.SendMail(ml); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("want 1 .eml file; got %v (%v)", files, err)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{
+		"To":                    "alice@example.com, bob@example.com",
+		"Cc":                    "carol@example.com",
+		"Bcc":                   "",
+		"Reply-To":              "support@greenlight.test",
+		"X-Campaign":            "welcome",
+		"List-Unsubscribe":      "<mailto:unsubscribe@greenlight.test>, <https://greenlight.test/unsubscribe?u=7>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	for name, want := range headers {
+		if got := msg.Header.Get(name); got != want {
+			t.Errorf("%s: want %q; got %q", name, want, got)
+		}
+	}
+
+	// 收集所有MIME部分的Content-Type和文件名
+	parts := map[string]string{}
+	var walk func(r io.Reader, contentType string)
+	walk = func(r io.Reader, contentType string) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(mediaType, "multipart/") {
+			return
+		}
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			partType := part.Header.Get("Content-Type")
+			if id := part.Header.Get("Content-Id"); id != "" {
+				parts[id] = partType
+			} else if name := part.FileName(); name != "" {
+				parts[name] = partType
+			}
+			walk(part, partType)
+		}
+	}
+	walk(msg.Body, msg.Header.Get("Content-Type"))
+
+	if !strings.HasPrefix(parts["<logo.png>"], "image/png") {
+		t.Errorf("want inline logo; got parts %v", parts)
+	}
+	if !strings.HasPrefix(parts["terms.txt"], "text/plain") {
+		t.Errorf("want terms.txt attachment; got parts %v", parts)
+	}
+}
+
+// TestSendMailValidation 测试没有收件人、无效地址和可以注入邮件头的自定义头被拒绝，且不发送邮件
+func TestSendMailValidation(t *testing.T) {
+	transport := NewMemory()
+	m := newTestMailer(t, transport, "no-reply@greenlight.test")
+	data := map[string]interface{}{"passwordResetToken": "RESET"}
+
+	tests := []struct {
+		name string
+		mail Mail
+	}{
+		{"no recipients", Mail{}},
+		{"invalid address", Mail{To: []string{"alice@example.com\r\nBcc: evil@example.com"}}},
+		{"header injection", Mail{To: []string{"alice@example.com"}, Headers: map[string]string{"X-Tag": "a\r\nBcc: evil@example.com"}}},
+		{"reserved header", Mail{To: []string{"alice@example.com"}, Headers: map[string]string{"subject": "spoofed"}}},
+		{"invalid filename", Mail{To: []string{"alice@example.com"}, Attachments: []Attachment{{Filename: "a\".txt"}}}},
+	}
+
+	for _, tt := range tests {
+		tt.mail.Template = "token_password_reset.tmpl"
+		tt.mail.Data = data
+		if err := m.SendMail(&tt.mail); err == nil {
+			t.Errorf("%s: want error", tt.name)
+		}
+	}
+	if n := len(transport.Messages()); n != 0 {
+		t.Errorf("want no messages sent; got %d", n)
+	}
+}
+
+// TestMatchLanguage 测试按Accept-Language的权重选择支持的语言，没有匹配时使用英文
+func TestMatchLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", "en"},
+		{"zh-CN", "zh-CN"},
+		{"zh-cn,en;q=0.5", "zh-CN"},
+		{"zh-Hans-CN;q=0.8, en-US", "en"},
+		{"fr-FR, zh;q=0.7, en;q=0.3", "zh-CN"},
+		{"fr, de;q=0.9", "en"},
+		{"zh;q=0, en", "en"},
+		{"*", "en"},
+	}
+
+	for _, tt := range tests {
+		if got := MatchLanguage(tt.acceptLanguage); got != tt.want {
+			t.Errorf("%q: want %s; got %s", tt.acceptLanguage, tt.want, got)
+		}
+	}
+}
+
+// TestLocalizedTemplates 测试使用用户语言的模板，没有翻译时使用英文模板，并且所有语言的翻译都是完整的
+func TestLocalizedTemplates(t *testing.T) {
+	transport := NewMemory()
+	m := newTestMailer(t, transport, "no-reply@greenlight.test")
+
+	data := map[string]interface{}{"ip": "203.0.113.7", "lockoutMinutes": 15}
+	for _, language := range []string{"zh-CN", "fr", ""} {
+		if err := m.SendLocalized("bob@example.com", language, "account_locked.tmpl", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := transport.Messages()
+	if !strings.Contains(messages[0].Subject, "账户已被暂时锁定") || !strings.Contains(messages[0].PlainBody, "15 分钟") {
+		t.Errorf("want Chinese template; got %q", messages[0].Subject)
+	}
+	for _, msg := range messages[1:] {
+		if !strings.Contains(msg.Subject, "temporarily locked") {
+			t.Errorf("want English fallback for %q; got %q", msg.Language, msg.Subject)
+		}
+	}
+
+	if missing := MissingTranslations(); len(missing) != 0 {
+		t.Errorf("want complete translations; missing %v", missing)
+	}
+}
+
+// TestParseTemplates 测试模板的语法错误、缺少定义和无法回退的翻译在解析时报告，并且模板数据缺少字段时渲染失败
+func TestParseTemplates(t *testing.T) {
+	valid := `{{define "subject"}}Hi {{.name}}{{end}}{{define "plainBody"}}text{{end}}{{define "htmlBody"}}<p>html</p>{{end}}`
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr []string
+	}{
+		{"valid", fstest.MapFS{"templates/en/a.tmpl": {Data: []byte(valid)}, "templates/zh-CN/a.tmpl": {Data: []byte(valid)}}, nil},
+		{"syntax error", fstest.MapFS{"templates/en/a.tmpl": {Data: []byte(`{{define "subject"}}{{.name}{{end}}`)}}, []string{"a.tmpl"}},
+		{
+			"missing definitions",
+			fstest.MapFS{"templates/en/a.tmpl": {Data: []byte(`{{define "subject"}}Hi{{end}}`)}},
+			[]string{"templates/en/a.tmpl: missing plainBody, htmlBody"},
+		},
+		{
+			"translation without english version",
+			fstest.MapFS{"templates/en/a.tmpl": {Data: []byte(valid)}, "templates/zh-CN/b.tmpl": {Data: []byte(valid)}},
+			[]string{"templates/zh-CN/b.tmpl: no en version"},
+		},
+		{"no templates", fstest.MapFS{}, []string{"no en templates"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := parseTemplates(tt.files)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				tmpl, _ := cache.lookup("fr", "a.tmpl")
+				if err := tmpl.ExecuteTemplate(io.Discard, "subject", map[string]interface{}{}); err == nil {
+					t.Error("want error for missing template data")
+				}
+				return
+			}
+			for _, want := range tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("want error containing %q; got %v", want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// TODO 该文件存储邮件模板的缓存：启动时一次性解析所有语言的模板并检查每个模板的定义是否完整
+
+// requiredTemplates 每个邮件模板必须定义的部分
+var requiredTemplates = []string{"subject", "plainBody", "htmlBody"}
+
+// templateCache 解析后的模板：语言 -> 模板文件名 -> 模板
+type templateCache map[string]map[string]*template.Template
+
+// parseTemplates 解析fsys中所有的 templates/<语言>/*.tmpl，返回包含所有问题的错误：
+// 语法错误、缺少subject/plainBody/htmlBody，以及翻译了DefaultLanguage中不存在的模板（无法回退）
+func parseTemplates(fsys fs.FS) (templateCache, error) {
+	files, err := fs.Glob(fsys, "templates/*/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	cache := templateCache{}
+	var errs []error
+	for _, file := range files {
+		language := path.Base(path.Dir(file))
+		name := path.Base(file)
+
+		// 模板数据缺少字段时报错，而不是在邮件中输出<no value>
+		tmpl, err := template.New(name).Option("missingkey=error").ParseFS(fsys, file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var missing []string
+		for _, required := range requiredTemplates {
+			if tmpl.Lookup(required) == nil {
+				missing = append(missing, required)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("%s: missing %s", file, strings.Join(missing, ", ")))
+			continue
+		}
+
+		if cache[language] == nil {
+			cache[language] = map[string]*template.Template{}
+		}
+		cache[language][name] = tmpl
+	}
+
+	if len(cache[DefaultLanguage]) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("no %s templates", DefaultLanguage))
+	}
+	for language, templates := range cache {
+		for name := range templates {
+			if _, ok := cache[DefaultLanguage][name]; !ok && language != DefaultLanguage {
+				errs = append(errs, fmt.Errorf("templates/%s/%s: no %s version to fall back to", language, name, DefaultLanguage))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid email templates: %w", errors.Join(errs...))
+	}
+	return cache, nil
+}
+
+// lookup 返回模板在指定语言下的版本，没有翻译时使用DefaultLanguage的版本
+func (c templateCache) lookup(language, name string) (*template.Template, error) {
+	if tmpl, ok := c[language][name]; ok {
+		return tmpl, nil
+	}
+	if tmpl, ok := c[DefaultLanguage][name]; ok {
+		return tmpl, nil
+	}
+	return nil, fmt.Errorf("unknown email template %q", name)
+}
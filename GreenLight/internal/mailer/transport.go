@@ -0,0 +1,200 @@
+package mailer
+
+import (
+	"DesignMode/GreenLight/internal/jsonlog"
+	"bytes"
+	"fmt"
+	"github.com/go-mail/mail/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TODO 该文件存储邮件的发送方式：SMTP、写入outbox目录的.eml文件、只记录日志和测试使用的内存记录
+
+// Message 渲染后的邮件
+type Message struct {
+	To          []string
+	Cc          []string
+	Bcc         []string // 只用于投递，不写入邮件头
+	ReplyTo     string
+	From        string
+	Subject     string
+	PlainBody   string
+	HTMLBody    string
+	Headers     map[string]string // 自定义邮件头，如List-Unsubscribe
+	Attachments []Attachment
+	Inline      []Attachment // 内嵌图片，HTML正文中通过 cid:<Filename> 引用
+	Template    string       // 生成邮件使用的模板文件，只用于日志和测试
+	Language    string       // 请求的模板语言，只用于日志和测试
+}
+
+// Attachment 邮件的附件或内嵌图片
+type Attachment struct {
+	Filename    string
+	ContentType string // 为空时根据文件扩展名推断
+	Data        []byte
+}
+
+// mime 将邮件转换为go-mail的消息，用于SMTP发送和写入.eml文件
+func (msg *Message) mime() *mail.Message {
+	m := mail.NewMessage()
+
+	// 按名称排序，生成的邮件头顺序稳定
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.SetHeader(name, msg.Headers[name])
+	}
+
+	m.SetHeader("To", msg.To...)
+	if len(msg.Cc) > 0 {
+		m.SetHeader("Cc", msg.Cc...)
+	}
+	// go-mail从Bcc头中读取收件人，但写入邮件时会跳过该头
+	if len(msg.Bcc) > 0 {
+		m.SetHeader("Bcc", msg.Bcc...)
+	}
+	if msg.ReplyTo != "" {
+		m.SetHeader("Reply-To", msg.ReplyTo)
+	}
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+
+	for _, a := range msg.Inline {
+		m.EmbedReader(a.Filename, bytes.NewReader(a.Data), a.settings()...)
+	}
+	for _, a := range msg.Attachments {
+		m.AttachReader(a.Filename, bytes.NewReader(a.Data), a.settings()...)
+	}
+	return m
+}
+
+// settings 指定了ContentType时覆盖go-mail根据扩展名推断的类型
+func (a Attachment) settings() []mail.FileSetting {
+	if a.ContentType == "" {
+		return nil
+	}
+	return []mail.FileSetting{mail.SetHeader(map[string][]string{
+		"Content-Type": {a.ContentType + `; name="` + a.Filename + `"`},
+	})}
+}
+
+// Transport 邮件的发送方式
+type Transport interface {
+	Send(msg *Message) error
+}
+
+// SMTP 通过SMTP服务器发送邮件
+type SMTP struct {
+	dialer *mail.Dialer
+}
+
+// NewSMTP 创建SMTP发送方式，username为空时不进行身份验证
+func NewSMTP(host string, port int, username, password string) *SMTP {
+	dialer := mail.NewDialer(host, port, username, password)
+	// 设置Dialer的超时时间为5秒，以防止连接耗时过长
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTP{dialer: dialer}
+}
+
+// Send 发送邮件。失败时直接返回错误，由调用方（发件箱）决定何时重试
+func (s *SMTP) Send(msg *Message) error {
+	return s.dialer.DialAndSend(msg.mime())
+}
+
+// File 将邮件写入outbox目录，每封邮件一个.eml文件，可以用邮件客户端直接打开
+type File struct {
+	dir string
+	seq atomic.Int64 // 同一时刻写入多封邮件时区分文件名
+}
+
+// NewFile 创建写入dir目录的发送方式，目录不存在时自动创建
+func NewFile(dir string) (*File, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+// Send 将邮件写入 时间-序号.eml 文件。先写入临时文件再重命名，读取outbox的程序不会看到写了一半的文件
+func (f *File) Send(msg *Message) error {
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405.000000000Z"), f.seq.Add(1))
+
+	tmp, err := os.CreateTemp(f.dir, ".eml-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = msg.mime().WriteTo(tmp)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(f.dir, name))
+}
+
+// Log 不发送邮件，只记录收件人、主题和纯文本正文（包含激活令牌等敏感信息，只用于开发环境）
+type Log struct {
+	logger *jsonlog.Logger
+}
+
+// NewLog 创建只记录日志的发送方式
+func NewLog(logger *jsonlog.Logger) *Log {
+	return &Log{logger: logger}
+}
+
+// Send 记录邮件
+func (l *Log) Send(msg *Message) error {
+	l.logger.PrintInfo("email not sent (log mail transport)", map[string]string{
+		"to":       strings.Join(msg.To, ", "),
+		"subject":  msg.Subject,
+		"template": msg.Template,
+		"language": msg.Language,
+		"body":     msg.PlainBody,
+	})
+	return nil
+}
+
+// Memory 将邮件保存在内存中，用于测试断言发送的邮件
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemory 创建内存发送方式
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send 保存邮件
+func (m *Memory) Send(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages 返回已发送邮件的副本
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,444 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// TODO 轻量的应用指标（只依赖标准库），同时支持expvar JSON和Prometheus文本格式输出
+
+// 指标类型（Prometheus TYPE）
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefBuckets 默认的直方图桶（单位秒），与Prometheus客户端的默认值一致
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector 一个已注册的指标
+type collector interface {
+	// writePrometheus 按Prometheus文本格式输出指标（不含HELP和TYPE行）
+	writePrometheus(w *bufio.Writer, name string)
+	// value 返回expvar中展示的值
+	value() interface{}
+}
+
+// entry 注册表中的一项
+type entry struct {
+	name      string
+	help      string
+	typ       string
+	collector collector
+}
+
+// Registry 指标注册表，实现了expvar.Var接口，可以通过expvar.Publish()发布
+type Registry struct {
+	mu      sync.Mutex
+	entries []entry
+	names   map[string]bool
+}
+
+// NewRegistry 创建一个指标注册表
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register 注册指标，名称重复时panic（属于编程错误）
+func (r *Registry) register(name, help, typ string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names[name] = true
+	r.entries = append(r.entries, entry{name: name, help: help, typ: typ, collector: c})
+}
+
+// snapshot 返回当前注册的全部指标
+func (r *Registry) snapshot() []entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]entry(nil), r.entries...)
+}
+
+// WritePrometheus 按Prometheus文本格式（version 0.0.4）输出全部指标
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range r.snapshot() {
+		fmt.Fprintf(bw, "# HELP %s %s\n", e.name, escapeHelp(e.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", e.name, e.typ)
+		e.collector.writePrometheus(bw, e.name)
+	}
+	return bw.Flush()
+}
+
+// String 返回全部指标的JSON表示，实现expvar.Var接口
+func (r *Registry) String() string {
+	values := make(map[string]interface{})
+	for _, e := range r.snapshot() {
+		values[e.name] = e.collector.value()
+	}
+	js, err := json.Marshal(values)
+	if err != nil {
+		return "{}"
+	}
+	return string(js)
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	n uint64
+}
+
+// NewCounter 注册一个计数器
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, typeCounter, c)
+	return c
+}
+
+// Inc 计数加一
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.n, 1)
+}
+
+// Value 当前计数
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.n)
+}
+
+func (c *Counter) writePrometheus(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, c.Value())
+}
+
+func (c *Counter) value() interface{} {
+	return c.Value()
+}
+
+// Gauge 可增可减的数值
+type Gauge struct {
+	n int64
+}
+
+// NewGauge 注册一个Gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, typeGauge, g)
+	return g
+}
+
+// Add 增加delta（可以为负数）
+func (g *Gauge) Add(delta int64) {
+	atomic.AddInt64(&g.n, delta)
+}
+
+// Value 当前值
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.n)
+}
+
+func (g *Gauge) writePrometheus(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, g.Value())
+}
+
+func (g *Gauge) value() interface{} {
+	return g.Value()
+}
+
+// funcMetric 在输出时调用函数取值的指标，用于数据库连接池、goroutine数量等已有的统计数据
+type funcMetric func() float64
+
+// NewGaugeFunc 注册一个在输出时取值的Gauge
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, help, typeGauge, funcMetric(fn))
+}
+
+// NewCounterFunc 注册一个在输出时取值的计数器，fn的返回值必须单调递增
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, help, typeCounter, funcMetric(fn))
+}
+
+func (f funcMetric) writePrometheus(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(f()))
+}
+
+func (f funcMetric) value() interface{} {
+	return f()
+}
+
+// CounterVec 按标签区分的一组计数器
+type CounterVec struct {
+	labels []string
+	mu     sync.Mutex
+	series map[string]*labeledCounter
+}
+
+type labeledCounter struct {
+	values []string
+	Counter
+}
+
+// NewCounterVec 注册一组带标签的计数器
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{labels: labels, series: make(map[string]*labeledCounter)}
+	r.register(name, help, typeCounter, v)
+	return v
+}
+
+// With 返回标签值对应的计数器，values的数量必须与标签数量一致
+func (v *CounterVec) With(values ...string) *Counter {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: want %d label values, got %d", len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, " ")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.series[key]
+	if !ok {
+		c = &labeledCounter{values: append([]string(nil), values...)}
+		v.series[key] = c
+	}
+	return &c.Counter
+}
+
+// sorted 按标签值排序后的全部序列，保证输出稳定
+func (v *CounterVec) sorted() ([]string, []*labeledCounter) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	series := make([]*labeledCounter, len(keys))
+	for i, key := range keys {
+		series[i] = v.series[key]
+	}
+	return keys, series
+}
+
+func (v *CounterVec) writePrometheus(w *bufio.Writer, name string) {
+	_, series := v.sorted()
+	for _, c := range series {
+		fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(v.labels, c.values, "", ""), c.Value())
+	}
+}
+
+func (v *CounterVec) value() interface{} {
+	keys, series := v.sorted()
+	values := make(map[string]uint64, len(keys))
+	for i, key := range keys {
+		values[key] = series[i].Value()
+	}
+	return values
+}
+
+// Histogram 直方图，记录观测值的分布
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64 // 每个桶（不累计）的数量，最后一个为+Inf
+	sum    float64
+	count  uint64
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// snapshot 返回累计的桶计数、总和和数量
+func (h *Histogram) snapshot() ([]uint64, float64, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cumulative := make([]uint64, len(h.counts))
+	var total uint64
+	for i, n := range h.counts {
+		total += n
+		cumulative[i] = total
+	}
+	return cumulative, h.sum, h.count
+}
+
+// HistogramVec 按标签区分的一组直方图
+type HistogramVec struct {
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*labeledHistogram
+}
+
+type labeledHistogram struct {
+	values []string
+	*Histogram
+}
+
+// NewHistogramVec 注册一组带标签的直方图，buckets必须升序排列
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets for %q are not sorted", name))
+	}
+	v := &HistogramVec{labels: labels, buckets: buckets, series: make(map[string]*labeledHistogram)}
+	r.register(name, help, typeHistogram, v)
+	return v
+}
+
+// With 返回标签值对应的直方图，values的数量必须与标签数量一致
+func (v *HistogramVec) With(values ...string) *Histogram {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: want %d label values, got %d", len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, " ")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h, ok := v.series[key]
+	if !ok {
+		h = &labeledHistogram{
+			values: append([]string(nil), values...),
+			Histogram: &Histogram{
+				buckets: v.buckets,
+				counts:  make([]uint64, len(v.buckets)+1),
+			},
+		}
+		v.series[key] = h
+	}
+	return h.Histogram
+}
+
+// sorted 按标签值排序后的全部序列
+func (v *HistogramVec) sorted() ([]string, []*labeledHistogram) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	series := make([]*labeledHistogram, len(keys))
+	for i, key := range keys {
+		series[i] = v.series[key]
+	}
+	return keys, series
+}
+
+func (v *HistogramVec) writePrometheus(w *bufio.Writer, name string) {
+	_, series := v.sorted()
+	for _, h := range series {
+		cumulative, sum, count := h.snapshot()
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(v.labels, h.values, "le", formatFloat(upper)), cumulative[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(v.labels, h.values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(v.labels, h.values, "", ""), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(v.labels, h.values, "", ""), count)
+	}
+}
+
+func (v *HistogramVec) value() interface{} {
+	type histogramValue struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}
+
+	keys, series := v.sorted()
+	values := make(map[string]histogramValue, len(keys))
+	for i, key := range keys {
+		cumulative, sum, count := series[i].snapshot()
+		hv := histogramValue{Count: count, Sum: sum, Buckets: make(map[string]uint64, len(v.buckets))}
+		for j, upper := range v.buckets {
+			hv.Buckets[formatFloat(upper)] = cumulative[j]
+		}
+		values[key] = hv
+	}
+	return values
+}
+
+// formatLabels 输出 {name="value",...}，extraName不为空时追加一个额外的标签（直方图的le）
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// 标签值需要转义反斜杠、双引号和换行符
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+// HELP文本需要转义反斜杠和换行符
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+// formatFloat 按Prometheus的格式输出浮点数
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
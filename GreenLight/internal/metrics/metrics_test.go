@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// TestWritePrometheus 测试Prometheus文本格式的输出
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounter("requests_total", "Total requests.")
+	inFlight := r.NewGauge("in_flight", "Requests in flight.")
+	responses := r.NewCounterVec("responses_total", "Responses by status.", "status")
+	r.NewGaugeFunc("goroutines", "Goroutines.", func() float64 { return 3 })
+	duration := r.NewHistogramVec("duration_seconds", "Duration.", []float64{0.1, 1}, "route")
+
+	requests.Inc()
+	requests.Inc()
+	inFlight.Add(1)
+	responses.With("500").Inc()
+	responses.With("200").Inc()
+	duration.With(`/v1/"x"`).Observe(0.1)
+	duration.With(`/v1/"x"`).Observe(0.5)
+	duration.With(`/v1/"x"`).Observe(3)
+
+	var buf bytes.Buffer
+	if err := r.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total 2
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP responses_total Responses by status.
+# TYPE responses_total counter
+responses_total{status="200"} 1
+responses_total{status="500"} 1
+# HELP goroutines Goroutines.
+# TYPE goroutines gauge
+goroutines 3
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/v1/\"x\"",le="0.1"} 1
+duration_seconds_bucket{route="/v1/\"x\"",le="1"} 2
+duration_seconds_bucket{route="/v1/\"x\"",le="+Inf"} 3
+duration_seconds_sum{route="/v1/\"x\""} 3.6
+duration_seconds_count{route="/v1/\"x\""} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestExpvar 测试注册表可以作为expvar.Var输出合法的JSON
+func TestExpvar(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("responses_total", "Responses by status.", "status").With("200").Inc()
+	r.NewHistogramVec("duration_seconds", "Duration.", DefBuckets, "method", "route").With("GET", "/v1/movies").Observe(0.2)
+
+	var values struct {
+		Responses map[string]uint64 `json:"responses_total"`
+		Duration  map[string]struct {
+			Count uint64 `json:"count"`
+		} `json:"duration_seconds"`
+	}
+	if err := json.Unmarshal([]byte(r.String()), &values); err != nil {
+		t.Fatal(err)
+	}
+	if values.Responses["200"] != 1 {
+		t.Errorf("want 1 response with status 200; got %v", values.Responses)
+	}
+	if values.Duration["GET /v1/movies"].Count != 1 {
+		t.Errorf("want 1 observation for GET /v1/movies; got %v", values.Duration)
+	}
+}
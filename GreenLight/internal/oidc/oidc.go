@@ -0,0 +1,324 @@
+package oidc
+
+import (
+	"DesignMode/GreenLight/internal/jwt"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TODO OpenID Connect 授权码 + PKCE 登录的客户端实现（发现、换取令牌、通过JWKS校验ID令牌）
+
+var (
+	// ErrInvalidIDToken ID令牌签名或声明校验失败
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+	// ErrInvalidNonce ID令牌中的nonce与登录开始时生成的不一致
+	ErrInvalidNonce = errors.New("oidc: invalid nonce")
+)
+
+// JWKS最短刷新间隔，避免携带未知kid的令牌导致频繁请求身份提供方
+const jwksMinRefresh = time.Minute
+
+// Config 身份提供方配置
+type Config struct {
+	Name         string   // 提供方名称，用于路由 /v1/oauth/:provider
+	Issuer       string   // 签发者，发现文档地址为 Issuer + "/.well-known/openid-configuration"
+	ClientID     string   // 客户端ID
+	ClientSecret string   // 客户端密钥，公开客户端可以为空（只使用PKCE）
+	RedirectURL  string   // 回调地址
+	Scopes       []string // 额外申请的scope，openid总是包含在内
+}
+
+// metadata 发现文档中用到的字段
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// TokenResponse 令牌端点返回的数据
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Claims ID令牌中的声明
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	Name            string `json:"name"`
+}
+
+// Provider 一个OpenID Connect身份提供方，发现文档和JWKS在第一次使用时获取并缓存
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        *jwt.KeySet
+	keysFetched time.Time
+}
+
+// NewProvider 创建身份提供方，client为nil时使用带超时的默认客户端
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Provider{Config: cfg, client: client}
+}
+
+// AuthCodeURL 返回授权端点地址，state用于防止CSRF，nonce用于绑定ID令牌，verifier为PKCE校验码
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.scopes(), " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", Challenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange 使用授权码和PKCE校验码换取令牌
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*TokenResponse, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		// client_secret_basic，规范要求先对ID和密钥进行URL编码
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &oauthErr)
+		return nil, fmt.Errorf("oidc: token endpoint returned %d: %s %s", res.StatusCode, oauthErr.Error, oauthErr.Description)
+	}
+
+	var tokens TokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("oidc: invalid token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	return &tokens, nil
+}
+
+// VerifyIDToken 通过JWKS校验ID令牌的签名，以及签发者、受众、过期时间和nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := p.jwks(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	err = keys.Parse(rawIDToken, &claims)
+	if errors.Is(err, jwt.ErrUnknownKey) {
+		// 身份提供方可能已经轮换了密钥，重新获取一次JWKS
+		keys, err = p.jwks(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		err = keys.Parse(rawIDToken, &claims)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if err := claims.Validate(time.Now(), meta.Issuer, p.ClientID); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	// 存在多个受众时，azp必须是当前客户端
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, fmt.Errorf("%w: invalid authorized party", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrInvalidNonce
+	}
+
+	return &claims, nil
+}
+
+// scopes 申请的scope列表，默认为 openid email profile
+func (p *Provider) scopes() []string {
+	if len(p.Scopes) == 0 {
+		return []string{"openid", "email", "profile"}
+	}
+	for _, s := range p.Scopes {
+		if s == "openid" {
+			return p.Scopes
+		}
+	}
+	return append([]string{"openid"}, p.Scopes...)
+}
+
+// discover 获取并缓存发现文档
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// 发现文档中的issuer必须与配置一致，防止被冒充
+	if strings.TrimSuffix(meta.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch: want %q, got %q", p.Issuer, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing required endpoints")
+	}
+
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// jwks 获取并缓存JWKS，refresh为true时在最短刷新间隔之外重新获取
+func (p *Provider) jwks(ctx context.Context, refresh bool) (*jwt.KeySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && (!refresh || time.Since(p.keysFetched) < jwksMinRefresh) {
+		return p.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := jwt.ParseJWKS(body)
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+	return keys, nil
+}
+
+// getJSON 发送GET请求并解码JSON响应
+func (p *Provider) getJSON(ctx context.Context, url string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	body, err := p.do(req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, dst)
+}
+
+// do 发送请求，非200响应返回错误
+func (p *Provider) do(req *http.Request) ([]byte, error) {
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: GET %s returned %d", req.URL, res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// RandomString 生成一个URL安全的随机字符串，用于state、nonce和PKCE校验码
+func RandomString() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// Challenge 根据PKCE校验码计算S256质询码（RFC 7636）
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
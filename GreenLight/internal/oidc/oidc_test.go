@@ -0,0 +1,99 @@
+package oidc_test
+
+import (
+	"DesignMode/GreenLight/internal/oidc"
+	"DesignMode/GreenLight/internal/oidc/oidctest"
+	"context"
+	"errors"
+	"testing"
+)
+
+// login 走一遍授权码 + PKCE流程，返回ID令牌
+func login(t *testing.T, idp *oidctest.Server, p *oidc.Provider, nonce, verifier string) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := callback.Query().Get("state"); got != "state-1" {
+		t.Fatalf("want state state-1; got %q", got)
+	}
+
+	tokens, err := p.Exchange(ctx, callback.Query().Get("code"), verifier)
+	if err != nil {
+		return "", err
+	}
+	return tokens.IDToken, nil
+}
+
+// TestLogin 测试完整的登录流程以及ID令牌的声明
+func TestLogin(t *testing.T) {
+	idp := oidctest.NewServer(t, "greenlight", "secret")
+	idp.SetUser(oidctest.User{Subject: "u-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	p := oidc.NewProvider(oidc.Config{
+		Name:         "company",
+		Issuer:       idp.Issuer(),
+		ClientID:     "greenlight",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:4000/v1/oauth/company/callback",
+	}, idp.Client())
+
+	verifier, _ := oidc.RandomString()
+	idToken, err := login(t, idp, p, "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := p.VerifyIDToken(context.Background(), idToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u-1" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.Name != "Alice" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	// nonce不一致时必须拒绝（防止重放）
+	_, err = p.VerifyIDToken(context.Background(), idToken, "other")
+	if !errors.Is(err, oidc.ErrInvalidNonce) {
+		t.Errorf("want ErrInvalidNonce; got %v", err)
+	}
+
+	// 其他客户端的ID令牌受众不匹配
+	other := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "someone-else"}, idp.Client())
+	_, err = other.VerifyIDToken(context.Background(), idToken, "nonce-1")
+	if !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("want ErrInvalidIDToken; got %v", err)
+	}
+}
+
+// TestExchangeRequiresVerifier 测试错误的PKCE校验码无法兑换授权码
+func TestExchangeRequiresVerifier(t *testing.T) {
+	idp := oidctest.NewServer(t, "greenlight", "")
+	p := oidc.NewProvider(oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    "greenlight",
+		RedirectURL: "http://localhost:4000/v1/oauth/company/callback",
+	}, idp.Client())
+
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Exchange(ctx, callback.Query().Get("code"), "verifier-2")
+	if err == nil {
+		t.Error("want exchange with wrong verifier to fail")
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"math"
+	"sync"
+	"time"
+)
+
+// TODO 请求限流：Limiter接口及进程内的令牌桶实现（单实例部署），多实例部署时使用共享的Redis滑动窗口实现
+
+// Limit 限流规则：平均每秒Rate个请求，最多Burst个请求的突发
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result 一次限流检查的结果，用于设置RateLimit-*和Retry-After响应头
+type Result struct {
+	Allowed    bool
+	Limit      int           // 规则允许的突发请求数
+	Remaining  int           // 本次请求后剩余可用的请求数
+	Reset      time.Duration // 剩余请求数恢复到Limit需要的时间
+	RetryAfter time.Duration // 被拒绝时，再次请求之前需要等待的时间
+}
+
+// Limiter 按key（如客户端IP）限流。规则随每次调用传入，配置热加载或不同路由使用不同规则时不需要重新创建Limiter。
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	Close() error
+}
+
+// 进程内限流器清理不活跃客户端的间隔和不活跃时间
+const (
+	memoryCleanupInterval = time.Minute
+	memoryIdleTimeout     = 3 * time.Minute
+)
+
+// Memory 进程内的令牌桶限流器，每个key一个令牌桶。
+// 状态只保存在当前进程中，部署多个实例时每个实例单独计数。
+type Memory struct {
+	mu      sync.Mutex
+	clients map[string]*memoryClient
+	done    chan struct{}
+	once    sync.Once
+}
+
+// memoryClient 一个key的令牌桶和最后使用时间
+type memoryClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemory 创建进程内限流器，并启动清理不活跃客户端的goroutine，Close时停止
+func NewMemory() *Memory {
+	m := &Memory{
+		clients: make(map[string]*memoryClient),
+		done:    make(chan struct{}),
+	}
+	go m.cleanup()
+	return m
+}
+
+// Allow 从key的令牌桶中取出一个令牌。规则变化后（如配置热加载）按新规则重新创建令牌桶。
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	c, found := m.clients[key]
+	if !found || c.limiter.Limit() != rate.Limit(limit.Rate) || c.limiter.Burst() != limit.Burst {
+		c = &memoryClient{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		m.clients[key] = c
+	}
+	c.lastSeen = now
+
+	allowed := c.limiter.AllowN(now, 1)
+	tokens := c.limiter.TokensAt(now)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     secondsToDuration((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+	return result, nil
+}
+
+// Close 停止清理goroutine
+func (m *Memory) Close() error {
+	m.once.Do(func() { close(m.done) })
+	return nil
+}
+
+// cleanup 定期删除超过memoryIdleTimeout没有请求的客户端
+func (m *Memory) cleanup() {
+	ticker := time.NewTicker(memoryCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			for key, c := range m.clients {
+				if time.Since(c.lastSeen) > memoryIdleTimeout {
+					delete(m.clients, key)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// secondsToDuration 将秒数转换为time.Duration，负数视为0
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds <= 0 || math.IsNaN(seconds) {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
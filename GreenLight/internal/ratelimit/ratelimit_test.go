@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"DesignMode/GreenLight/internal/redis"
+	"DesignMode/GreenLight/internal/redis/redistest"
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestRedis 连接到进程内的Redis替身
+func newTestRedis(t *testing.T, srv *redistest.Server) *Redis {
+	t.Helper()
+
+	opts, err := redis.ParseURL(srv.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewRedis(redis.New(opts), "test:")
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// TestLimiters 测试两种实现的基本行为：突发请求数、被拒绝后的等待时间、不同key单独计数和恢复
+func TestLimiters(t *testing.T) {
+	limiters := map[string]Limiter{
+		"memory": NewMemory(),
+		"redis":  newTestRedis(t, redistest.NewServer(t)),
+	}
+
+	for name, l := range limiters {
+		t.Run(name, func(t *testing.T) {
+			defer l.Close()
+			ctx := context.Background()
+			limit := Limit{Rate: 20, Burst: 3}
+
+			for i := 0; i < 3; i++ {
+				res, err := l.Allow(ctx, "1.2.3.4", limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !res.Allowed || res.Limit != 3 || res.Remaining != 2-i {
+					t.Fatalf("request %d: unexpected result %+v", i, res)
+				}
+			}
+
+			res, err := l.Allow(ctx, "1.2.3.4", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed || res.Remaining != 0 || res.RetryAfter <= 0 || res.RetryAfter > 150*time.Millisecond {
+				t.Errorf("want request rejected with a short retry; got %+v", res)
+			}
+
+			if res, _ := l.Allow(ctx, "5.6.7.8", limit); !res.Allowed {
+				t.Error("want other keys to be limited separately")
+			}
+
+			time.Sleep(res.RetryAfter + 10*time.Millisecond)
+			if res, _ := l.Allow(ctx, "1.2.3.4", limit); !res.Allowed {
+				t.Errorf("want request allowed after waiting; got %+v", res)
+			}
+		})
+	}
+}
+
+// TestRedisShared 测试多个实例共享Redis时共同计数，Redis不可用时返回错误
+func TestRedisShared(t *testing.T) {
+	srv := redistest.NewServer(t)
+	srv.RequirePassword("secret")
+	a, b := newTestRedis(t, srv), newTestRedis(t, srv)
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i, l := range []*Redis{a, b} {
+		if res, err := l.Allow(ctx, "ip:1.2.3.4", limit); err != nil || !res.Allowed {
+			t.Fatalf("instance %d: want allowed; got %+v, %v", i, res, err)
+		}
+	}
+	res, err := a.Allow(ctx, "ip:1.2.3.4", limit)
+	if err != nil || res.Allowed {
+		t.Fatalf("want third request across instances rejected; got %+v, %v", res, err)
+	}
+	if res.RetryAfter < time.Second || res.RetryAfter > 2*time.Second {
+		t.Errorf("want retry after about 2s window; got %s", res.RetryAfter)
+	}
+	if srv.Keys() != 1 {
+		t.Errorf("want one key in redis; got %d", srv.Keys())
+	}
+
+	srv.Close()
+	if _, err := b.Allow(ctx, "ip:1.2.3.4", limit); err == nil {
+		t.Error("want error when redis is unavailable")
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"DesignMode/GreenLight/internal/redis"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Redis 基于Redis有序集合的滑动窗口限流器，多个实例共享同一个Redis时共同计数。
+// 规则Limit{Rate, Burst}换算为每 Burst/Rate 秒的窗口内最多Burst个请求：
+// 有序集合中保存窗口内每个请求的时间戳，超过窗口的记录在每次检查时删除。
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis 创建Redis限流器，prefix用于区分与其他数据共用Redis时的key
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+// Allow 在一个事务中删除窗口外的记录、记录本次请求并统计窗口内的请求数。
+// 超出限制的请求会删除刚记录的时间戳，被拒绝的请求不占用窗口内的名额。
+func (l *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		return Result{}, fmt.Errorf("ratelimit: invalid limit %+v", limit)
+	}
+
+	window := secondsToDuration(float64(limit.Burst) / limit.Rate)
+	if window < time.Millisecond {
+		window = time.Millisecond
+	}
+	now := time.Now()
+	nowMicro := now.UnixMicro()
+	member, err := uniqueMember(nowMicro)
+	if err != nil {
+		return Result{}, err
+	}
+
+	key = l.prefix + key
+	replies, err := l.client.Tx(ctx,
+		[]string{"ZREMRANGEBYSCORE", key, "-inf", strconv.FormatInt(nowMicro-window.Microseconds(), 10)},
+		[]string{"ZADD", key, strconv.FormatInt(nowMicro, 10), member},
+		[]string{"ZCARD", key},
+		[]string{"ZRANGE", key, "0", "0", "WITHSCORES"},
+		[]string{"PEXPIRE", key, strconv.FormatInt(window.Milliseconds()+1, 10)},
+	)
+	if err != nil {
+		return Result{}, err
+	}
+	count, ok := replies[2].(int64)
+	if !ok {
+		return Result{}, errors.New("ratelimit: unexpected ZCARD reply")
+	}
+
+	// 最早的请求离开窗口后才会空出名额
+	oldest := nowMicro
+	if items, ok := replies[3].([]interface{}); ok && len(items) == 2 {
+		if score, ok := items[1].(string); ok {
+			if f, err := strconv.ParseFloat(score, 64); err == nil {
+				oldest = int64(f)
+			}
+		}
+	}
+	untilOldestExpires := time.Duration(oldest-nowMicro)*time.Microsecond + window
+
+	result := Result{
+		Allowed:   count <= int64(limit.Burst),
+		Limit:     limit.Burst,
+		Remaining: limit.Burst - int(count),
+		Reset:     untilOldestExpires,
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if !result.Allowed {
+		result.RetryAfter = untilOldestExpires
+		if _, err := l.client.Do(ctx, "ZREM", key, member); err != nil {
+			return Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// Close 关闭Redis连接
+func (l *Redis) Close() error {
+	return l.client.Close()
+}
+
+// uniqueMember 生成有序集合的成员，时间戳相同的请求也不会相互覆盖
+func uniqueMember(nowMicro int64) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(nowMicro, 10) + "-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,128 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TODO 获取客户端的真实IP：只有直接连接的对端是可信代理时才读取X-Forwarded-For、X-Real-IP或Forwarded，
+// 并从右向左跳过可信代理，避免客户端伪造请求头绕过按IP的限流和锁定
+
+// Proxies 可信代理的网段列表
+type Proxies []*net.IPNet
+
+// ParseProxies 解析CIDR列表，单个IP地址视为只包含该地址的网段
+func ParseProxies(specs []string) (Proxies, error) {
+	proxies := make(Proxies, 0, len(specs))
+	for _, spec := range specs {
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", spec)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy CIDR %q", spec)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// Contains 判断ip是否属于可信代理
+func (p Proxies) Contains(ip net.IP) bool {
+	for _, ipNet := range p {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromRequest 返回请求的客户端IP。
+// 对端不是可信代理时直接使用对端地址；否则按 Forwarded > X-Forwarded-For > X-Real-IP 的顺序
+// 读取代理链，从右向左跳过可信代理，返回第一个不可信的地址。
+// 代理链中出现无法解析的地址（如Forwarded中的unknown或混淆标识）时，返回添加该地址的代理。
+func FromRequest(r *http.Request, trusted Proxies) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !trusted.Contains(peerIP) {
+		return peer
+	}
+
+	chain := forwardedChain(r.Header)
+	if len(chain) == 0 {
+		chain = forwardedForChain(r.Header)
+	}
+	if len(chain) == 0 {
+		if ip := parseIP(r.Header.Get("X-Real-IP")); ip != nil {
+			return ip.String()
+		}
+		return peerIP.String()
+	}
+
+	client := peerIP
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseIP(chain[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !trusted.Contains(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedForChain 返回所有X-Forwarded-For请求头中的地址，按从客户端到代理的顺序
+func forwardedForChain(h http.Header) []string {
+	var chain []string
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			chain = append(chain, strings.TrimSpace(addr))
+		}
+	}
+	return chain
+}
+
+// forwardedChain 返回RFC 7239 Forwarded请求头中每个元素的for参数，按从客户端到代理的顺序。
+// 缺少for参数的元素记为空字符串，表示无法确定该跳的地址。
+func forwardedChain(h http.Header) []string {
+	var chain []string
+	for _, value := range h.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					node = strings.Trim(val, `"`)
+				}
+			}
+			chain = append(chain, node)
+		}
+	}
+	return chain
+}
+
+// parseIP 解析代理链中的一个地址，支持带端口的形式（1.2.3.4:80、[2001:db8::1]:80）
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+}
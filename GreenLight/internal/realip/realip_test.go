@@ -0,0 +1,52 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestFromRequest 测试只有可信代理转发的请求才使用转发请求头，并从右向左跳过可信代理
+func TestFromRequest(t *testing.T) {
+	trusted, err := ParseProxies([]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer ignores headers", "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.7"},
+		{"trusted peer without headers", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"x-forwarded-for", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed x-forwarded-for", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"all hops trusted", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"invalid hop", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.1, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"x-real-ip", "192.0.2.1:5000", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		{"forwarded", "10.0.0.1:5000", map[string]string{"Forwarded": `for=198.51.100.1;proto=https, for="[2001:db8::5]:4711"`}, "198.51.100.1"},
+		{"forwarded ipv6 client", "10.0.0.1:5000", map[string]string{"Forwarded": `for="[2001:db9::1]"`}, "2001:db9::1"},
+		{"forwarded unknown", "10.0.0.1:5000", map[string]string{"Forwarded": "for=198.51.100.1, for=unknown, for=10.0.0.2"}, "10.0.0.2"},
+		{"forwarded preferred", "10.0.0.1:5000", map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "1.1.1.1"}, "198.51.100.1"},
+		{"ipv6 peer", "[2001:db8::1]:5000", map[string]string{"X-Forwarded-For": "198.51.100.1:1234"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := FromRequest(r, trusted); got != tt.want {
+				t.Errorf("want %s; got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := ParseProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("want invalid CIDR error")
+	}
+}
@@ -0,0 +1,302 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TODO 最小的Redis客户端（RESP2协议），只支持执行命令和MULTI/EXEC事务，连接池中的连接可以复用
+
+// ErrClosed 客户端已关闭
+var ErrClosed = errors.New("redis: client closed")
+
+// Error Redis服务器返回的错误回复
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Options 连接配置
+type Options struct {
+	Addr        string        // host:port
+	Password    string        // 为空时不执行AUTH
+	DB          int           // 连接后SELECT的数据库
+	DialTimeout time.Duration // 建立连接的超时时间
+	PoolSize    int           // 连接池中保留的空闲连接数
+}
+
+// ParseURL 解析 redis://[:password@]host[:port][/db] 格式的地址
+func ParseURL(rawURL string) (Options, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Options{}, err
+	}
+	if u.Scheme != "redis" {
+		return Options{}, fmt.Errorf("redis: unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return Options{}, errors.New("redis: missing host")
+	}
+
+	opts := Options{Addr: u.Host}
+	if u.Port() == "" {
+		opts.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		opts.Password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		opts.DB, err = strconv.Atoi(db)
+		if err != nil || opts.DB < 0 {
+			return Options{}, fmt.Errorf("redis: invalid database %q", db)
+		}
+	}
+	return opts, nil
+}
+
+// Client Redis客户端，可以并发使用
+type Client struct {
+	opts Options
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// New 创建客户端，连接在第一次执行命令时建立
+func New(opts Options) *Client {
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	return &Client{opts: opts}
+}
+
+// Do 执行一条命令。回复按类型转换为string、int64、[]interface{}，空回复为nil；错误回复返回Error。
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	replies, err := c.roundTrip(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(Error); ok {
+		return nil, e
+	}
+	return replies[0], nil
+}
+
+// Tx 在一个MULTI/EXEC事务中依次执行命令并返回每条命令的回复，命令之间不会插入其他客户端的命令
+func (c *Client) Tx(ctx context.Context, cmds ...[]string) ([]interface{}, error) {
+	batch := make([][]string, 0, len(cmds)+2)
+	batch = append(batch, []string{"MULTI"})
+	batch = append(batch, cmds...)
+	batch = append(batch, []string{"EXEC"})
+
+	replies, err := c.roundTrip(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies[:len(replies)-1] {
+		if e, ok := reply.(Error); ok {
+			return nil, e
+		}
+	}
+	switch exec := replies[len(replies)-1].(type) {
+	case Error:
+		return nil, exec
+	case []interface{}:
+		return exec, nil
+	default:
+		return nil, errors.New("redis: transaction aborted")
+	}
+}
+
+// Close 关闭客户端和所有空闲连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// roundTrip 一次性写入一组命令并读取相同数量的回复，网络错误时丢弃连接
+func (c *Client) roundTrip(ctx context.Context, cmds [][]string) ([]interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := cn.roundTrip(ctx, cmds)
+	if err != nil {
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+// get 取出一个空闲连接，没有时建立新连接
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	return c.dial(ctx)
+}
+
+// put 将连接放回连接池，连接池已满或客户端已关闭时关闭连接
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || len(c.idle) >= c.opts.PoolSize {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// dial 建立连接并完成认证和数据库选择
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := net.Dialer{Timeout: c.opts.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]string
+	if c.opts.Password != "" {
+		setup = append(setup, []string{"AUTH", c.opts.Password})
+	}
+	if c.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	if len(setup) > 0 {
+		replies, err := cn.roundTrip(ctx, setup)
+		if err == nil {
+			for _, reply := range replies {
+				if e, ok := reply.(Error); ok {
+					err = e
+					break
+				}
+			}
+		}
+		if err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// conn 一个Redis连接
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// roundTrip 写入命令并读取回复，ctx的截止时间用作连接的读写超时
+func (cn *conn) roundTrip(ctx context.Context, cmds [][]string) ([]interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for _, args := range cmds {
+		fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	for i := range replies {
+		reply, err := ReadReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// ReadReply 读取一个RESP回复，错误回复作为Error值返回而不是error
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = ReadReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// readLine 读取以\r\n结尾的一行，不包含\r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
@@ -0,0 +1,532 @@
+package redistest
+
+import (
+	"DesignMode/GreenLight/internal/redis"
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TODO 用于测试的进程内Redis替身，只实现限流等功能用到的命令（字符串计数、有序集合、过期时间和MULTI/EXEC事务）
+
+// Server 模拟的Redis服务器，所有数据保存在内存中
+type Server struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	password string // 不为空时要求客户端先执行AUTH
+	strings  map[string]string
+	zsets    map[string]map[string]float64
+	expires  map[string]time.Time
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// NewServer 在随机端口上启动一个模拟的Redis服务器，测试结束时自动关闭
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		ln:      ln,
+		strings: make(map[string]string),
+		zsets:   make(map[string]map[string]float64),
+		expires: make(map[string]time.Time),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// URL 返回 redis:// 格式的连接地址
+func (s *Server) URL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.Addr()
+	}
+	return "redis://" + s.Addr()
+}
+
+// RequirePassword 要求之后建立的连接先使用password执行AUTH
+func (s *Server) RequirePassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// Close 关闭服务器和所有连接，用于模拟Redis不可用
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.ln.Close()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Keys 返回当前未过期的key数量
+func (s *Server) Keys() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for key := range s.strings {
+		if !s.expired(key) {
+			n++
+		}
+	}
+	for key := range s.zsets {
+		if !s.expired(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+// handle 处理一个连接上的命令，事务中的命令在EXEC时持有锁一次执行完
+func (s *Server) handle(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	s.mu.Lock()
+	password := s.password
+	s.mu.Unlock()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	authenticated := password == ""
+	var queued [][]string
+	inTx, txFailed := false, false
+
+	for {
+		reply, err := redis.ReadReply(r)
+		if err != nil {
+			return
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) == 0 {
+			writeReply(w, redis.Error("ERR protocol error"))
+			w.Flush()
+			return
+		}
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		name := strings.ToUpper(args[0])
+
+		switch {
+		case name == "AUTH":
+			if len(args) == 2 && args[1] == password {
+				authenticated = true
+				writeReply(w, "OK")
+			} else {
+				writeReply(w, redis.Error("WRONGPASS invalid password"))
+			}
+		case !authenticated:
+			writeReply(w, redis.Error("NOAUTH Authentication required."))
+		case name == "MULTI":
+			inTx, txFailed, queued = true, false, nil
+			writeReply(w, "OK")
+		case name == "EXEC":
+			if !inTx {
+				writeReply(w, redis.Error("ERR EXEC without MULTI"))
+				break
+			}
+			inTx = false
+			if txFailed {
+				writeReply(w, redis.Error("EXECABORT Transaction discarded because of previous errors."))
+				break
+			}
+			s.mu.Lock()
+			results := make([]interface{}, len(queued))
+			for i, cmd := range queued {
+				results[i] = s.exec(cmd)
+			}
+			s.mu.Unlock()
+			writeReply(w, results)
+		case name == "DISCARD":
+			inTx, queued = false, nil
+			writeReply(w, "OK")
+		case inTx:
+			if _, ok := commands[name]; !ok {
+				txFailed = true
+				writeReply(w, redis.Error("ERR unknown command '"+args[0]+"'"))
+				break
+			}
+			queued = append(queued, args)
+			writeReply(w, "QUEUED")
+		default:
+			s.mu.Lock()
+			result := s.exec(args)
+			s.mu.Unlock()
+			writeReply(w, result)
+		}
+
+		// 客户端会一次写入多条命令，读完缓冲区中的命令后再发送回复
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// commands 支持的命令，调用时已持有s.mu
+var commands = map[string]func(s *Server, args []string) interface{}{
+	"PING":             func(s *Server, args []string) interface{} { return "PONG" },
+	"SELECT":           func(s *Server, args []string) interface{} { return "OK" },
+	"GET":              (*Server).get,
+	"SET":              (*Server).set,
+	"INCR":             (*Server).incr,
+	"DEL":              (*Server).del,
+	"PEXPIRE":          (*Server).pexpire,
+	"PTTL":             (*Server).pttl,
+	"ZADD":             (*Server).zadd,
+	"ZREM":             (*Server).zrem,
+	"ZCARD":            (*Server).zcard,
+	"ZRANGE":           (*Server).zrange,
+	"ZREMRANGEBYSCORE": (*Server).zremrangebyscore,
+}
+
+// 命令的参数个数（包括命令名），负数表示至少需要的个数
+var arity = map[string]int{
+	"PING": -1, "SELECT": 2, "GET": 2, "SET": 3, "INCR": 2, "DEL": -2, "PEXPIRE": 3, "PTTL": 2,
+	"ZADD": -4, "ZREM": -3, "ZCARD": 2, "ZRANGE": -4, "ZREMRANGEBYSCORE": 4,
+}
+
+func (s *Server) exec(args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	fn, ok := commands[name]
+	if !ok {
+		return redis.Error("ERR unknown command '" + args[0] + "'")
+	}
+	if n := arity[name]; (n > 0 && len(args) != n) || (n < 0 && len(args) < -n) {
+		return redis.Error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+	}
+	return fn(s, args)
+}
+
+// expired 删除已过期的key，返回key是否已过期
+func (s *Server) expired(key string) bool {
+	at, ok := s.expires[key]
+	if !ok || time.Now().Before(at) {
+		return false
+	}
+	delete(s.strings, key)
+	delete(s.zsets, key)
+	delete(s.expires, key)
+	return true
+}
+
+func (s *Server) get(args []string) interface{} {
+	s.expired(args[1])
+	if v, ok := s.strings[args[1]]; ok {
+		return v
+	}
+	return nil
+}
+
+func (s *Server) set(args []string) interface{} {
+	delete(s.zsets, args[1])
+	delete(s.expires, args[1])
+	s.strings[args[1]] = args[2]
+	return "OK"
+}
+
+func (s *Server) incr(args []string) interface{} {
+	s.expired(args[1])
+	n, err := strconv.ParseInt(s.stringOr(args[1], "0"), 10, 64)
+	if err != nil {
+		return redis.Error("ERR value is not an integer or out of range")
+	}
+	n++
+	s.strings[args[1]] = strconv.FormatInt(n, 10)
+	return n
+}
+
+func (s *Server) stringOr(key, fallback string) string {
+	if v, ok := s.strings[key]; ok {
+		return v
+	}
+	return fallback
+}
+
+func (s *Server) del(args []string) interface{} {
+	var n int64
+	for _, key := range args[1:] {
+		if s.expired(key) {
+			continue
+		}
+		_, isString := s.strings[key]
+		_, isZSet := s.zsets[key]
+		if isString || isZSet {
+			n++
+		}
+		delete(s.strings, key)
+		delete(s.zsets, key)
+		delete(s.expires, key)
+	}
+	return n
+}
+
+func (s *Server) exists(key string) bool {
+	if s.expired(key) {
+		return false
+	}
+	_, isString := s.strings[key]
+	_, isZSet := s.zsets[key]
+	return isString || isZSet
+}
+
+func (s *Server) pexpire(args []string) interface{} {
+	ms, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.Error("ERR value is not an integer or out of range")
+	}
+	if !s.exists(args[1]) {
+		return int64(0)
+	}
+	s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+	return int64(1)
+}
+
+func (s *Server) pttl(args []string) interface{} {
+	if !s.exists(args[1]) {
+		return int64(-2)
+	}
+	at, ok := s.expires[args[1]]
+	if !ok {
+		return int64(-1)
+	}
+	return int64(time.Until(at) / time.Millisecond)
+}
+
+// zset 返回有序集合，key保存的是字符串时返回错误
+func (s *Server) zset(key string, create bool) (map[string]float64, interface{}) {
+	s.expired(key)
+	if _, ok := s.strings[key]; ok {
+		return nil, redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	z, ok := s.zsets[key]
+	if !ok && create {
+		z = make(map[string]float64)
+		s.zsets[key] = z
+	}
+	return z, nil
+}
+
+func (s *Server) zadd(args []string) interface{} {
+	if len(args)%2 != 0 {
+		return redis.Error("ERR syntax error")
+	}
+	z, errReply := s.zset(args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	var added int64
+	for i := 2; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return redis.Error("ERR value is not a valid float")
+		}
+		if _, ok := z[args[i+1]]; !ok {
+			added++
+		}
+		z[args[i+1]] = score
+	}
+	return added
+}
+
+func (s *Server) zrem(args []string) interface{} {
+	z, errReply := s.zset(args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	var removed int64
+	for _, member := range args[2:] {
+		if _, ok := z[member]; ok {
+			delete(z, member)
+			removed++
+		}
+	}
+	s.dropEmpty(args[1])
+	return removed
+}
+
+func (s *Server) zcard(args []string) interface{} {
+	z, errReply := s.zset(args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	return int64(len(z))
+}
+
+// zrange 只支持按下标范围查询，可选WITHSCORES
+func (s *Server) zrange(args []string) interface{} {
+	z, errReply := s.zset(args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	start, err1 := strconv.Atoi(args[2])
+	stop, err2 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil {
+		return redis.Error("ERR value is not an integer or out of range")
+	}
+	withScores := len(args) == 5 && strings.EqualFold(args[4], "WITHSCORES")
+	if len(args) > 4 && !withScores {
+		return redis.Error("ERR syntax error")
+	}
+
+	members := sortedMembers(z)
+	n := len(members)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	result := []interface{}{}
+	for i := start; i <= stop; i++ {
+		result = append(result, members[i])
+		if withScores {
+			result = append(result, formatScore(z[members[i]]))
+		}
+	}
+	return result
+}
+
+func (s *Server) zremrangebyscore(args []string) interface{} {
+	z, errReply := s.zset(args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	min, err1 := parseScoreBound(args[2])
+	max, err2 := parseScoreBound(args[3])
+	if err1 != nil || err2 != nil {
+		return redis.Error("ERR min or max is not a float")
+	}
+	var removed int64
+	for member, score := range z {
+		if score >= min && score <= max {
+			delete(z, member)
+			removed++
+		}
+	}
+	s.dropEmpty(args[1])
+	return removed
+}
+
+// dropEmpty 与Redis一样，有序集合为空时删除key
+func (s *Server) dropEmpty(key string) {
+	if z, ok := s.zsets[key]; ok && len(z) == 0 {
+		delete(s.zsets, key)
+		delete(s.expires, key)
+	}
+}
+
+// sortedMembers 按分数从小到大排序，分数相同时按成员排序
+func sortedMembers(z map[string]float64) []string {
+	members := make([]string, 0, len(z))
+	for member := range z {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if z[members[i]] != z[members[j]] {
+			return z[members[i]] < z[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// parseScoreBound 解析分数范围，支持-inf和+inf（不支持开区间）
+func parseScoreBound(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), nil
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// writeReply 按RESP格式写入回复
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case redis.Error:
+		fmt.Fprintf(w, "-%s\r\n", string(v))
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		// 简单回复（OK、QUEUED、PONG）使用+，其余使用bulk字符串
+		if v == "OK" || v == "QUEUED" || v == "PONG" {
+			fmt.Fprintf(w, "+%s\r\n", v)
+		} else {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
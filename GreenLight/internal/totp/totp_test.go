@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRFC6238Vectors 使用RFC 6238附录B中的SHA1测试向量
+func TestRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		got := hotp(key, counter(time.Unix(tt.unix, 0)), 8)
+		if got != tt.want {
+			t.Errorf("time %d: want %s; got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+// TestValidate 测试验证码校验以及时钟误差容忍
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Validate(secret, code, now) {
+		t.Error("want current code to be valid")
+	}
+	if !Validate(strings.ToLower(secret), code, now.Add(Period)) {
+		t.Error("want code from previous step to be valid")
+	}
+	if Validate(secret, code, now.Add(3*Period)) {
+		t.Error("want code from three steps ago to be invalid")
+	}
+	if Validate(secret, "12345", now) {
+		t.Error("want code with wrong length to be invalid")
+	}
+
+	// 误差窗口内返回验证码所属的时间步数，而不是校验时的时间步数
+	if c, ok := ValidateCounter(secret, code, now.Add(Period)); !ok || c != counter(now) {
+		t.Errorf("want counter %d; got %d (%v)", counter(now), c, ok)
+	}
+}
+
+// TestProvisioningURI 测试生成的URI可以被解析
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Greenlight", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("unexpected uri %q", uri)
+	}
+	if got := u.Query().Get("secret"); got != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("want secret JBSWY3DPEHPK3PXP; got %q", got)
+	}
+	if got := u.Path; got != "/Greenlight:alice@example.com" {
+		t.Errorf("unexpected label %q", got)
+	}
+}
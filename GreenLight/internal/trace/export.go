@@ -0,0 +1,297 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TODO 该文件存储span的导出器（JSON行格式写入文件/标准输出、OTLP/HTTP JSON）和传播traceparent的http.RoundTripper
+
+// writerSpan JSON行格式中的一个span
+type writerSpan struct {
+	Service      string                 `json:"service"`
+	Name         string                 `json:"name"`
+	Kind         string                 `json:"kind"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Start        time.Time              `json:"start"`
+	DurationMS   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Error        bool                   `json:"error,omitempty"`
+	Message      string                 `json:"message,omitempty"`
+}
+
+// WriterExporter 将span以每行一个JSON对象的格式写入io.Writer，适合本地调试
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter 创建一个写入w的导出器
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// Export 写入一批span
+func (e *WriterExporter) Export(ctx context.Context, service string, spans []*SpanData) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, s := range spans {
+		ws := writerSpan{
+			Service:    service,
+			Name:       s.Name,
+			Kind:       s.Kind.String(),
+			TraceID:    s.TraceID.String(),
+			SpanID:     s.SpanID.String(),
+			Start:      s.Start.UTC(),
+			DurationMS: float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+			Attributes: s.Attributes,
+			Error:      s.Error,
+			Message:    s.Message,
+		}
+		if s.ParentSpanID != (SpanID{}) {
+			ws.ParentSpanID = s.ParentSpanID.String()
+		}
+		if err := enc.Encode(ws); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// Shutdown 将写入的内容同步到磁盘（如果io.Writer支持），不会关闭io.Writer
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s, ok := e.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// String 返回span类型的名称
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+// OTLPExporter 通过OTLP/HTTP（JSON编码）导出span，兼容OpenTelemetry Collector、Jaeger、Tempo等
+type OTLPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewOTLPExporter 创建OTLP导出器，endpoint为完整地址（如 http://localhost:4318/v1/traces），client为nil时使用默认的客户端
+func NewOTLPExporter(endpoint string, client *http.Client) *OTLPExporter {
+	if client == nil {
+		client = &http.Client{Timeout: exportTimeout}
+	}
+	return &OTLPExporter{endpoint: endpoint, client: client}
+}
+
+// OTLP JSON编码的请求结构，只包含用到的字段
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 未设置，2 错误
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64按OTLP JSON的约定编码为字符串
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// Export 将一批span发送到OTLP端点
+func (e *OTLPExporter) Export(ctx context.Context, service string, spans []*SpanData) error {
+	req := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{otlpAttribute("service.name", service)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "DesignMode/GreenLight/internal/trace"},
+				Spans: make([]otlpSpan, 0, len(spans)),
+			}},
+		}},
+	}
+
+	scope := &req.ResourceSpans[0].ScopeSpans[0]
+	for _, s := range spans {
+		out := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.ParentSpanID != (SpanID{}) {
+			out.ParentSpanID = s.ParentSpanID.String()
+		}
+		if s.Error {
+			out.Status = otlpStatus{Code: 2, Message: s.Message}
+		}
+
+		// 按key排序，输出稳定
+		keys := make([]string, 0, len(s.Attributes))
+		for key := range s.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			out.Attributes = append(out.Attributes, otlpAttribute(key, s.Attributes[key]))
+		}
+
+		scope.Spans = append(scope.Spans, out)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Shutdown OTLP导出器没有需要释放的资源
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// otlpAttribute 将属性值转换为OTLP的AnyValue，不支持的类型按字符串输出
+func otlpAttribute(key string, value interface{}) otlpKeyValue {
+	var v otlpAnyValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.FormatInt(int64(value), 10)
+		v.IntValue = &s
+	case int32:
+		s := strconv.FormatInt(int64(value), 10)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+// Transport 为每个发出的HTTP请求创建一个客户端span，并通过traceparent请求头传播给下游
+type Transport struct {
+	Base http.RoundTripper // 为nil时使用http.DefaultTransport
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := Start(r.Context(), "HTTP "+r.Method, SpanKindClient)
+	if span == nil {
+		return base.RoundTrip(r)
+	}
+	defer span.End()
+
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.url", r.URL.Scheme+"://"+r.URL.Host+r.URL.Path)
+
+	// RoundTripper不能修改原请求，克隆后再设置请求头
+	r = r.Clone(ctx)
+	r.Header.Set("traceparent", span.SpanContext().Traceparent())
+
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.RecordError(fmt.Errorf("server returned %s", resp.Status))
+	}
+	return resp, nil
+}
@@ -0,0 +1,399 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TODO 与OpenTelemetry兼容的轻量分布式追踪（只依赖标准库）：W3C traceparent传播，批量导出到OTLP/HTTP或文件
+
+// SpanKind span类型，与OTLP中的取值一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// 批量导出的参数
+const (
+	queueSize     = 2048
+	maxBatchSize  = 512
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// TraceID 16字节的追踪ID
+type TraceID [16]byte
+
+// SpanID 8字节的span ID
+type SpanID [8]byte
+
+// String 返回十六进制表示
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// String 返回十六进制表示
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext 跨进程传播的span标识
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid 追踪ID和span ID都不能全为0
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent 返回W3C traceparent请求头的值
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent 解析W3C traceparent请求头，格式错误时返回false
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	// 版本00必须恰好有4个部分，更高的版本允许在末尾追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if strings.ToLower(value) != value {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&0x01 == 1
+
+	return sc, sc.IsValid()
+}
+
+// SpanData 已结束的span，交给Exporter导出
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Error        bool
+	Message      string
+}
+
+// Exporter 将span导出到外部系统
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Span 一个正在进行的操作。nil的*Span表示不采样，所有方法都可以安全调用。
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext 返回span的传播标识
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Sampled: true}
+}
+
+// SetAttribute 设置属性，value支持string、bool、整数和浮点数
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// RecordError 将span标记为错误
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = true
+	s.data.Message = err.Error()
+}
+
+// End 结束span并放入导出队列，重复调用无效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.enqueue(&data)
+}
+
+// Tracer 创建span并批量导出
+type Tracer struct {
+	service     string
+	exporter    Exporter
+	sampleRatio float64
+
+	mu      sync.RWMutex // 保护queue的关闭
+	closed  bool
+	queue   chan *SpanData
+	done    chan struct{}
+	dropped uint64
+	onError func(error)
+}
+
+// NewTracer 创建一个Tracer，exporter为nil时不记录任何span。
+// sampleRatio为没有上游traceparent时的采样比例，有上游时沿用上游的采样决定。
+func NewTracer(service string, exporter Exporter, sampleRatio float64, onError func(error)) *Tracer {
+	t := &Tracer{
+		service:     service,
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+		onError:     onError,
+	}
+	if exporter == nil {
+		return t
+	}
+
+	t.queue = make(chan *SpanData, queueSize)
+	t.done = make(chan struct{})
+	go t.run()
+
+	return t
+}
+
+// Enabled 是否启用了导出
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.exporter != nil
+}
+
+// Dropped 因队列已满而丢弃的span数量
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Start 创建一个span，ctx中已有span时作为其子span，否则使用ctx中的远程父span（traceparent）或创建新的追踪
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if !t.Enabled() {
+		return ctx, nil
+	}
+
+	var parent SpanContext
+	if s := SpanFromContext(ctx); s != nil {
+		parent = s.SpanContext()
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		// 上游没有采样时，本服务也不采样
+		if !remote.Sampled {
+			return ctx, nil
+		}
+		parent = remote
+	}
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Start:      time.Now(),
+			Attributes: make(map[string]interface{}),
+		},
+	}
+
+	if parent.IsValid() {
+		span.data.TraceID = parent.TraceID
+		span.data.ParentSpanID = parent.SpanID
+	} else {
+		span.data.TraceID = newTraceID()
+		if !t.sample(span.data.TraceID) {
+			return ctx, nil
+		}
+	}
+	span.data.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// sample 按追踪ID的低8字节决定是否采样，同一个追踪的决定总是一致的
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.sampleRatio >= 1:
+		return true
+	case t.sampleRatio <= 0:
+		return false
+	default:
+		return float64(binary.BigEndian.Uint64(id[8:])>>11)/(1<<53) < t.sampleRatio
+	}
+}
+
+// enqueue 放入导出队列，队列已满或正在关闭时丢弃
+func (t *Tracer) enqueue(data *SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		atomic.AddUint64(&t.dropped, 1)
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+// run 后台批量导出，达到批量大小或每隔flushInterval导出一次
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, maxBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := t.exporter.Export(ctx, t.service, batch); err != nil && t.onError != nil {
+			t.onError(fmt.Errorf("trace: export %d spans: %w", len(batch), err))
+		}
+		batch = make([]*SpanData, 0, maxBatchSize)
+	}
+
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Shutdown 导出队列中剩余的span并关闭Exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if !t.Enabled() {
+		return nil
+	}
+
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// 上下文key
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// SpanFromContext 返回ctx中当前的span，没有时返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent 返回包含上游span标识的新上下文，之后创建的span作为它的子span
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// 默认的Tracer，由main()根据配置设置，未设置时不记录span
+var defaultTracer atomic.Value
+
+// SetDefault 设置默认的Tracer
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start 使用ctx中父span的Tracer（没有时使用默认的Tracer）创建span
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if parent := SpanFromContext(ctx); parent != nil {
+		return parent.tracer.Start(ctx, name, kind)
+	}
+	t, _ := defaultTracer.Load().(*Tracer)
+	return t.Start(ctx, name, kind)
+}
+
+// newTraceID 生成随机的追踪ID
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID 生成随机的span ID
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,206 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recordingExporter 在内存中记录导出的span
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (e *recordingExporter) Export(ctx context.Context, service string, spans []*SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error { return nil }
+
+// TestParseTraceparent 测试traceparent请求头的解析和输出
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, ok := ParseTraceparent(valid)
+	if !ok {
+		t.Fatalf("want %q to be valid", valid)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+	if got := sc.Traceparent(); got != valid {
+		t.Errorf("want %q; got %q", valid, got)
+	}
+
+	tests := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	}
+	for _, value := range tests {
+		if _, ok := ParseTraceparent(value); ok {
+			t.Errorf("want %q to be invalid", value)
+		}
+	}
+
+	// 更高的版本允许追加字段
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Error("want future version with extra fields to be valid")
+	}
+}
+
+// TestTracer 测试父子span、上游采样决定的沿用和关闭时的导出
+func TestTracer(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer("test", exporter, 1, nil)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemoteParent(context.Background(), remote)
+
+	ctx, parent := tracer.Start(ctx, "parent", SpanKindServer)
+	_, child := Start(ctx, "child", SpanKindClient)
+	child.SetAttribute("db.system", "mysql")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+	parent.End()
+
+	// 上游没有采样时不创建span
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	if _, span := tracer.Start(ContextWithRemoteParent(context.Background(), unsampled), "skipped", SpanKindServer); span != nil {
+		t.Error("want no span for an unsampled parent")
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("want 2 spans; got %d", len(exporter.spans))
+	}
+	c, p := exporter.spans[0], exporter.spans[1]
+	if p.TraceID != remote.TraceID || p.ParentSpanID != remote.SpanID {
+		t.Errorf("want parent span to continue the remote trace; got %+v", p)
+	}
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID {
+		t.Errorf("want child span to be a child of the parent; got %+v", c)
+	}
+	if !c.Error || c.Message != "boom" || c.Attributes["db.system"] != "mysql" {
+		t.Errorf("unexpected child span %+v", c)
+	}
+
+	// 关闭之后结束的span被丢弃
+	_, late := tracer.Start(context.Background(), "late", SpanKindInternal)
+	late.End()
+	if tracer.Dropped() != 1 {
+		t.Errorf("want 1 dropped span; got %d", tracer.Dropped())
+	}
+}
+
+// TestDisabledTracer 测试未配置导出器时不创建span
+func TestDisabledTracer(t *testing.T) {
+	tracer := NewTracer("test", nil, 1, nil)
+	ctx, span := tracer.Start(context.Background(), "op", SpanKindInternal)
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Fatal("want no span from a disabled tracer")
+	}
+	span.SetAttribute("key", "value")
+	span.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOTLPExporter 测试OTLP/HTTP JSON格式的导出和Transport传播traceparent
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		body        map[string]interface{}
+		traceparent string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/traces":
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+		default:
+			traceparent = r.Header.Get("traceparent")
+		}
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer("greenlight", NewOTLPExporter(collector.URL+"/v1/traces", nil), 1, nil)
+
+	ctx, span := tracer.Start(context.Background(), "GET /v1/movies", SpanKindServer)
+	span.SetAttribute("http.status_code", 200)
+
+	client := &http.Client{Transport: &Transport{}}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, collector.URL+"/downstream", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	sc, ok := ParseTraceparent(traceparent)
+	if !ok || sc.TraceID != span.SpanContext().TraceID {
+		t.Errorf("want downstream traceparent in trace %s; got %q", span.SpanContext().TraceID, traceparent)
+	}
+
+	resourceSpans, _ := body["resourceSpans"].([]interface{})
+	if len(resourceSpans) != 1 {
+		t.Fatalf("want 1 resourceSpans entry; got %v", body)
+	}
+	rs := resourceSpans[0].(map[string]interface{})
+	attr, _ := json.Marshal(rs["resource"].(map[string]interface{})["attributes"].([]interface{})[0])
+	if string(attr) != `{"key":"service.name","value":{"stringValue":"greenlight"}}` {
+		t.Errorf("unexpected resource attribute %s", attr)
+	}
+
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans; got %d", len(spans))
+	}
+	server := spans[1].(map[string]interface{})
+	if server["traceId"] != span.SpanContext().TraceID.String() || server["kind"] != float64(SpanKindServer) {
+		t.Errorf("unexpected server span %v", server)
+	}
+	if _, ok := server["startTimeUnixNano"].(string); !ok {
+		t.Errorf("want startTimeUnixNano encoded as a string; got %v", server["startTimeUnixNano"])
+	}
+	status, _ := json.Marshal(server["attributes"])
+	if string(status) != `[{"key":"http.status_code","value":{"intValue":"200"}}]` {
+		t.Errorf("unexpected attributes %s", status)
+	}
+	downstream := spans[0].(map[string]interface{})
+	if downstream["parentSpanId"] != span.SpanContext().SpanID.String() {
+		t.Errorf("want client span to be a child of the server span; got %v", downstream)
+	}
+}
@@ -2,35 +2,67 @@ package vcs
 
 import (
 	"fmt"
+	"runtime"
 	"runtime/debug"
 )
 
-func Version() string {
-	var (
-		time     string
-		revision string
-		modified bool
-	)
+// Info 构建信息：版本号、VCS提交、构建时间、Go版本和依赖模块的版本
+type Info struct {
+	Version      string   `json:"version"`
+	Commit       string   `json:"commit,omitempty"`
+	Dirty        bool     `json:"dirty"`
+	BuildTime    string   `json:"build_time,omitempty"`
+	GoVersion    string   `json:"go_version"`
+	Dependencies []Module `json:"dependencies,omitempty"`
+}
+
+// Module 依赖模块，被replace时Version为替换后的版本
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// Read 读取二进制文件中的构建信息。version为应用的语义化版本号（通常通过-ldflags -X设置），
+// 为空时使用主模块的版本（go install module@version构建时才有）。
+// 没有构建信息（如go test）时只返回版本号和Go版本。
+func Read(version string) Info {
+	info := Info{Version: version, GoVersion: runtime.Version()}
 
 	bi, ok := debug.ReadBuildInfo()
-	if ok {
-		for _, s := range bi.Settings {
-			switch s.Key {
-			case "vcs.time":
-				time = s.Value
-			case "vcs.revision":
-				revision = s.Value
-			case "vcs.modified":
-				if s.Value == "true" {
-					modified = true
-				}
-			}
+	if !ok {
+		return info
+	}
+	if info.Version == "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.modified":
+			info.Dirty = s.Value == "true"
+		}
+	}
+
+	for _, dep := range bi.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
 		}
+		info.Dependencies = append(info.Dependencies, Module{Path: dep.Path, Version: dep.Version})
 	}
+	return info
+}
+
+// Version 返回 构建时间-提交[-dirty] 格式的VCS版本
+func Version() string {
+	info := Read("")
 
-	if modified {
-		return fmt.Sprintf("%s-%s-dirty", time, revision)
+	if info.Dirty {
+		return fmt.Sprintf("%s-%s-dirty", info.BuildTime, info.Commit)
 	}
 
-	return fmt.Sprintf("%s-%s", time, revision)
+	return fmt.Sprintf("%s-%s", info.BuildTime, info.Commit)
 }
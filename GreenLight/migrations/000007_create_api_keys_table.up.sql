@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    hash binary(32) NOT NULL UNIQUE,
+    user_id bigint NOT NULL,
+    name varchar(100) NOT NULL,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expiry datetime NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_keys_permissions (
+    api_key_id bigint NOT NULL,
+    permission_id bigint NOT NULL,
+    PRIMARY KEY (api_key_id, permission_id),
+    FOREIGN KEY (api_key_id) REFERENCES api_keys (id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE
+);
@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name varchar(100) NOT NULL UNIQUE,
+    description varchar(500) NOT NULL DEFAULT '',
+    version int NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL,
+    permission_id bigint NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL,
+    role_id bigint NOT NULL,
+    PRIMARY KEY (user_id, role_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    actor_id bigint NOT NULL,
+    action varchar(100) NOT NULL,
+    target_type varchar(100) NOT NULL,
+    target_id varchar(100) NOT NULL,
+    details text NOT NULL,
+    INDEX audit_log_target_idx (target_type, target_id)
+);
+
+INSERT IGNORE INTO permissions (code)
+VALUES ('movies:read'), ('movies:write'), ('roles:admin');
+
+INSERT IGNORE INTO roles (name, description)
+VALUES
+    ('viewer', 'Read-only access to movies'),
+    ('editor', 'Read and write access to movies'),
+    ('admin', 'Full access including role management');
+
+INSERT IGNORE INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name = 'viewer' AND permissions.code = 'movies:read')
+   OR (roles.name = 'editor' AND permissions.code IN ('movies:read', 'movies:write'))
+   OR roles.name = 'admin';
@@ -0,0 +1,7 @@
+INSERT IGNORE INTO permissions (code)
+VALUES ('users:admin');
+
+INSERT IGNORE INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'users:admin';
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS users_totp (
+    user_id bigint NOT NULL PRIMARY KEY,
+    secret varchar(64) NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    hash binary(32) NOT NULL,
+    used_at datetime NULL,
+    UNIQUE KEY recovery_codes_user_hash_idx (user_id, hash),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    provider varchar(64) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(255) NOT NULL DEFAULT '',
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY user_identities_provider_subject_idx (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
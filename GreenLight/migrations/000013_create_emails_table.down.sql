@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'emails:admin';
+DROP TABLE IF EXISTS emails;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS emails (
+    id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    recipient varchar(255) NOT NULL,
+    template varchar(255) NOT NULL,
+    data text NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error varchar(1024) NOT NULL DEFAULT '',
+    sent_at datetime NULL,
+    KEY emails_status_next_attempt_idx (status, next_attempt_at)
+);
+
+INSERT IGNORE INTO permissions (code)
+VALUES ('emails:admin');
+
+INSERT IGNORE INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'emails:admin';
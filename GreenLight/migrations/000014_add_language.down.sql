@@ -0,0 +1,2 @@
+ALTER TABLE emails DROP COLUMN language;
+ALTER TABLE users DROP COLUMN language;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN language varchar(16) NOT NULL DEFAULT 'en';
+ALTER TABLE emails ADD COLUMN language varchar(16) NOT NULL DEFAULT 'en';
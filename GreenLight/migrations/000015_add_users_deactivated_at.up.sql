@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN deactivated_at datetime NULL;
+
+UPDATE users
+SET deactivated_at = (
+    SELECT max(audit_log.created_at) FROM audit_log
+    WHERE audit_log.action = 'user.deactivate' AND audit_log.target_type = 'user' AND audit_log.target_id = users.id
+)
+WHERE activated = false AND EXISTS (
+    SELECT 1 FROM audit_log
+    WHERE audit_log.action = 'user.deactivate' AND audit_log.target_type = 'user' AND audit_log.target_id = users.id
+);
@@ -0,0 +1 @@
+ALTER TABLE users_totp DROP COLUMN last_counter;
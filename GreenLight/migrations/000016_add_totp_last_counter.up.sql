@@ -0,0 +1 @@
+ALTER TABLE users_totp ADD COLUMN last_counter bigint NOT NULL DEFAULT 0;